@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/semver"
+	"github.com/azylman/govend/vend"
+)
+
+var cmdAudit = &Command{
+	Name:  "audit",
+	Args:  "[packages]",
+	Short: "check dependencies against an offline OSV advisory database",
+	Run:   runAudit,
+}
+
+var (
+	auditDB        string
+	auditReachable bool
+	auditJSON      bool
+)
+
+func init() {
+	cmdAudit.Flag.StringVar(&auditDB, "db", "", "advisory database: an OSV JSON `file`, or a directory of them")
+	cmdAudit.Flag.BoolVar(&auditReachable, "reachable", false, "only report advisories whose vulnerable code the packages import")
+	cmdAudit.Flag.BoolVar(&auditJSON, "json", false, "print findings as JSON")
+}
+
+// An advisory is the subset of the OSV schema govend understands.
+// See https://ossf.github.io/osv-schema/.
+type advisory struct {
+	ID       string             `json:"id"`
+	Summary  string             `json:"summary"`
+	Aliases  []string           `json:"aliases"`
+	Affected []advisoryAffected `json:"affected"`
+}
+
+type advisoryAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges []struct {
+		Type   string `json:"type"`
+		Events []struct {
+			Introduced   string `json:"introduced"`
+			Fixed        string `json:"fixed"`
+			LastAffected string `json:"last_affected"`
+		} `json:"events"`
+	} `json:"ranges"`
+	Versions          []string `json:"versions"`
+	EcosystemSpecific struct {
+		Imports []struct {
+			Path    string   `json:"path"`
+			Symbols []string `json:"symbols"`
+		} `json:"imports"`
+	} `json:"ecosystem_specific"`
+}
+
+// A finding is an advisory that affects the vendored packages
+// of one repo.
+type finding struct {
+	ID          string
+	Aliases     []string `json:",omitempty"`
+	Summary     string   `json:",omitempty"`
+	Root        string   // Import path of the repo root.
+	ImportPaths []string // The affected packages vendored from it.
+	Rev         string
+	Version     string `json:",omitempty"` // Empty if the rev has no version tag.
+	Fixed       string `json:",omitempty"` // Lowest version fixing the advisory, if known.
+
+	// Vulnerable import paths and symbols, from the
+	// advisory; an empty Symbols means the whole package.
+	Imports map[string][]string `json:"-"`
+}
+
+func runAudit(cmd *Command, args []string) error {
+	if auditDB == "" {
+		cmd.usage()
+	}
+	if len(args) == 0 {
+		args = []string{"./..."}
+	}
+	db, err := readAdvisories(auditDB)
+	if err != nil {
+		return err
+	}
+	manifest, err := vend.CurrentManifest(vend.VendorDir)
+	if err != nil {
+		return err
+	}
+	if err := pkgs.FillRoots(manifest.Deps); err != nil {
+		return err
+	}
+	findings := matchAdvisories(db, manifest.Deps)
+	if auditReachable && len(findings) > 0 {
+		graph, err := pkgs.LoadGraph(args...)
+		if err != nil {
+			return err
+		}
+		if findings, err = reachable(graph, findings); err != nil {
+			return err
+		}
+	}
+	if auditJSON {
+		err = writeJSON(os.Stdout, findings)
+	} else {
+		err = writeFindings(os.Stdout, findings)
+	}
+	if err != nil {
+		return err
+	}
+	if n := countAdvisories(findings); n > 0 {
+		return fmt.Errorf("%d advisories affect dependencies", n)
+	}
+	return nil
+}
+
+// countAdvisories returns the number of distinct advisories in
+// findings, which has one finding per advisory and affected repo.
+func countAdvisories(findings []finding) int {
+	ids := make(map[string]bool)
+	for _, f := range findings {
+		ids[f.ID] = true
+	}
+	return len(ids)
+}
+
+// readAdvisories reads the OSV entries in the file at name, which
+// holds either one entry or an array of them, or, if name is a
+// directory, in all the .json files in it.
+func readAdvisories(name string) ([]advisory, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{name}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(name, "*.json")); err != nil {
+			return nil, err
+		}
+	}
+	var db []advisory
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entries []advisory
+		if err := json.Unmarshal(b, &entries); err != nil {
+			var entry advisory
+			if err := json.Unmarshal(b, &entry); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			entries = []advisory{entry}
+		}
+		db = append(db, entries...)
+	}
+	return db, nil
+}
+
+// matchAdvisories returns the advisories in db that affect deps,
+// one finding per advisory and repo, listing the affected packages
+// of the repo. The version of a dependency is its Tag or, failing
+// that, the tag in its Comment. A dependency with no version is only
+// matched by advisories listing its Comment or Rev as an affected
+// version. Each of deps must have its Root set.
+func matchAdvisories(db []advisory, deps []pkgs.Dependency) []finding {
+	type key struct{ id, root string }
+	findings := []finding{}
+	byKey := make(map[key]int) // index in findings
+	for _, dep := range deps {
+		tag := dep.Tag
+		if tag == "" {
+			// A revision past a tag is taken to be at it.
+			tag, _ = vend.DescribeTag(dep.Comment)
+		}
+		v, verr := semver.Parse(tag)
+		for _, adv := range db {
+			for _, aff := range adv.Affected {
+				name := aff.Package.Name
+				if aff.Package.Ecosystem != "Go" || !(dep.ImportPath == name || strings.HasPrefix(dep.ImportPath, name+"/")) {
+					continue
+				}
+				affected := containsString(aff.Versions, dep.Comment) || containsString(aff.Versions, dep.Rev)
+				var fixed string
+				if verr == nil {
+					affected = affected || aff.affects(v)
+					fixed = aff.fixedAfter(v)
+				}
+				if !affected {
+					continue
+				}
+				k := key{adv.ID, dep.Root}
+				i, ok := byKey[k]
+				if !ok {
+					f := finding{
+						ID:      adv.ID,
+						Aliases: adv.Aliases,
+						Summary: adv.Summary,
+						Root:    dep.Root,
+						Rev:     dep.Rev,
+						Fixed:   fixed,
+						Imports: make(map[string][]string),
+					}
+					if verr == nil {
+						f.Version = tag
+					}
+					i = len(findings)
+					byKey[k] = i
+					findings = append(findings, f)
+				}
+				f := &findings[i]
+				if !containsString(f.ImportPaths, dep.ImportPath) {
+					f.ImportPaths = append(f.ImportPaths, dep.ImportPath)
+				}
+				for _, imp := range aff.EcosystemSpecific.Imports {
+					f.Imports[imp.Path] = imp.Symbols
+				}
+				if len(aff.EcosystemSpecific.Imports) == 0 {
+					f.Imports[dep.ImportPath] = nil
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// affects reports whether v is in one of a's SEMVER ranges.
+// Events in a range alternate between introducing and fixing
+// the vulnerability; "0" introduces it from the beginning.
+func (a advisoryAffected) affects(v semver.Version) bool {
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		in := false
+		for _, e := range r.Events {
+			switch {
+			case e.Introduced == "0":
+				in = true
+			case e.Introduced != "":
+				if iv, err := semver.Parse(e.Introduced); err == nil && !v.Less(iv) {
+					in = true
+				}
+			case e.Fixed != "":
+				if fv, err := semver.Parse(e.Fixed); err == nil && !v.Less(fv) {
+					in = false
+				}
+			case e.LastAffected != "":
+				if lv, err := semver.Parse(e.LastAffected); err == nil && lv.Less(v) {
+					in = false
+				}
+			}
+		}
+		if in {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedAfter returns the lowest fixed version in a above v.
+func (a advisoryAffected) fixedAfter(v semver.Version) string {
+	var best string
+	var bestv semver.Version
+	for _, r := range a.Ranges {
+		for _, e := range r.Events {
+			fv, err := semver.Parse(e.Fixed)
+			if e.Fixed == "" || err != nil || !v.Less(fv) {
+				continue
+			}
+			if best == "" || fv.Less(bestv) {
+				best, bestv = e.Fixed, fv
+			}
+		}
+	}
+	return best
+}
+
+// reachable returns the findings whose vulnerable packages are in
+// graph and, if the advisory names vulnerable symbols, for which
+// some package in graph refers to one of those symbols.
+//
+// This is an approximation, since it doesn't follow calls: a
+// symbol counts as reachable if any importer of the vulnerable
+// package refers to it, or for a method T.M, to T or to any M.
+func reachable(graph map[string]*pkgs.Package, findings []finding) ([]finding, error) {
+	kept := []finding{}
+	for _, f := range findings {
+		hit := false
+		for path, symbols := range f.Imports {
+			if graph[path] == nil {
+				continue
+			}
+			if len(symbols) == 0 {
+				hit = true
+				break
+			}
+			ok, err := refersTo(graph, path, symbols)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				hit = true
+				break
+			}
+		}
+		if hit {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
+
+// refersTo reports whether any importer of path in graph
+// refers to one of symbols from it.
+func refersTo(graph map[string]*pkgs.Package, path string, symbols []string) (bool, error) {
+	want := make(map[string]bool)
+	for _, sym := range symbols {
+		for _, s := range strings.Split(sym, ".") {
+			want[s] = true
+		}
+	}
+	for _, p := range graph {
+		if p.Standard || !containsString(p.Imports, path) {
+			continue
+		}
+		for _, name := range p.Files() {
+			ok, err := fileRefersTo(name, path, want)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// fileRefersTo reports whether the Go file name imports path and
+// refers to one of the names in want. Any selector with a wanted
+// name counts, since methods can't be resolved without type checking.
+func fileRefersTo(name, path string, want map[string]bool) (bool, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	local := ""
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || pkgs.Unqualify(p) != path {
+			continue
+		}
+		local = path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+	}
+	if local == "" || local == "_" {
+		return false, nil
+	}
+	found := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			found = found || want[n.Sel.Name]
+		case *ast.Ident:
+			found = found || (local == "." && want[n.Name])
+		}
+		return !found
+	})
+	return found, nil
+}
+
+func writeFindings(w io.Writer, findings []finding) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tREPO\tPACKAGES\tVERSION\tFIXED\tSUMMARY")
+	for _, f := range findings {
+		version := f.Version
+		if version == "" {
+			version = shortRev(f.Rev)
+		}
+		fixed := f.Fixed
+		if fixed == "" {
+			fixed = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", f.ID, f.Root, strings.Join(f.ImportPaths, ","), version, fixed, f.Summary)
+	}
+	return tw.Flush()
+}
+
+func containsString(a []string, s string) bool {
+	for _, t := range a {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
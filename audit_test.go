@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdvisories = `[
+	{
+		"id": "GO-0001",
+		"summary": "D is broken",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "D"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.0"}, {"introduced": "1.3.0"}, {"fixed": "1.3.2"}]}],
+			"ecosystem_specific": {"imports": [{"path": "D/A", "symbols": ["Parse"]}]}
+		}]
+	},
+	{
+		"id": "GO-0002",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "E"},
+			"versions": ["E1"]
+		}]
+	},
+	{
+		"id": "PYSEC-0001",
+		"affected": [{"package": {"ecosystem": "PyPI", "name": "D"}, "versions": ["v1.1.0"]}]
+	}
+]`
+
+func TestMatchAdvisories(t *testing.T) {
+	var db []advisory
+	assert.Nil(t, json.Unmarshal([]byte(testAdvisories), &db))
+
+	cases := []struct {
+		dep   pkgs.Dependency
+		want  []string
+		fixed string
+	}{
+		{pkgs.Dependency{ImportPath: "D/A", Root: "D", Comment: "v1.1.0"}, []string{"GO-0001"}, "1.2.0"},
+		{pkgs.Dependency{ImportPath: "D/A", Root: "D", Comment: "v1.1.0-4-gabcdef0"}, []string{"GO-0001"}, "1.2.0"},
+		{pkgs.Dependency{ImportPath: "D/A", Root: "D", Comment: "v1.2.0"}, nil, ""},
+		{pkgs.Dependency{ImportPath: "D/A", Root: "D", Tag: "v1.3.1"}, []string{"GO-0001"}, "1.3.2"},
+		{pkgs.Dependency{ImportPath: "D/A", Root: "D", Comment: "v1.3.2"}, nil, ""},
+		{pkgs.Dependency{ImportPath: "DE", Root: "DE", Comment: "v1.1.0"}, nil, ""},
+		{pkgs.Dependency{ImportPath: "E", Root: "E", Comment: "E1"}, []string{"GO-0002"}, ""},
+		{pkgs.Dependency{ImportPath: "E", Root: "E", Comment: "E2"}, nil, ""},
+	}
+	for _, test := range cases {
+		var got []string
+		findings := matchAdvisories(db, []pkgs.Dependency{test.dep})
+		for _, f := range findings {
+			got = append(got, f.ID)
+			assert.Equal(t, test.fixed, f.Fixed)
+		}
+		assert.Equal(t, test.want, got, "%s at %s%s", test.dep.ImportPath, test.dep.Comment, test.dep.Tag)
+	}
+}
+
+func TestMatchAdvisoriesPerRepo(t *testing.T) {
+	var db []advisory
+	assert.Nil(t, json.Unmarshal([]byte(testAdvisories), &db))
+
+	deps := []pkgs.Dependency{
+		{ImportPath: "D/A", Root: "D", Rev: "d1", Comment: "v1.1.0"},
+		{ImportPath: "D/B", Root: "D", Rev: "d1", Comment: "v1.1.0"},
+		{ImportPath: "E", Root: "E", Rev: "e1", Comment: "E1"},
+		{ImportPath: "E/F", Root: "E", Rev: "e1", Comment: "E1"},
+	}
+	findings := matchAdvisories(db, deps)
+	if assert.Equal(t, 2, len(findings)) {
+		assert.Equal(t, "GO-0001", findings[0].ID)
+		assert.Equal(t, "D", findings[0].Root)
+		assert.Equal(t, []string{"D/A", "D/B"}, findings[0].ImportPaths)
+		assert.Equal(t, map[string][]string{"D/A": {"Parse"}}, findings[0].Imports)
+		assert.Equal(t, "GO-0002", findings[1].ID)
+		assert.Equal(t, []string{"E", "E/F"}, findings[1].ImportPaths)
+		assert.Equal(t, map[string][]string{"E": nil, "E/F": nil}, findings[1].Imports)
+	}
+
+	// One advisory affecting two repos counts once.
+	findings = append(findings, finding{ID: "GO-0001", Root: "G"})
+	assert.Equal(t, 2, countAdvisories(findings))
+}
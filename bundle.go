@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/vcs"
+	"github.com/azylman/govend/vend"
+)
+
+var cmdBundle = &Command{
+	Name:  "bundle",
+	Args:  "path",
+	Short: "write the repos of all dependencies to a vendor bundle at path",
+	Run:   runBundle,
+}
+
+var (
+	bundleCacheDir string
+	bundleProfile  string
+)
+
+func init() {
+	cmdBundle.Flag.StringVar(&bundleCacheDir, "cache-dir", cache.DefaultDir(), "`directory` of the private cache")
+	cmdBundle.Flag.StringVar(&bundleProfile, "profile", "", "bundle the dependencies of the `profile` named in Govend.toml")
+}
+
+func runBundle(cmd *Command, args []string) error {
+	if len(args) != 1 {
+		cmd.usage()
+	}
+	vendor := vend.VendorDir
+	if bundleProfile != "" {
+		p, err := lookupProfile(bundleProfile)
+		if err != nil {
+			return err
+		}
+		vendor = p.Vendor
+	}
+	return bundle(args[0], vendor, &cache.Cache{Dir: bundleCacheDir})
+}
+
+// bundle writes a snapshot of the repo of each dependency in the
+// manifest of the vendor directory, at its recorded revision, to
+// the archive at path. The repos are fetched into c if it doesn't
+// have them already.
+func bundle(path, vendor string, c *cache.Cache) error {
+	manifest, err := vend.CurrentManifest(vendor)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Deps) == 0 {
+		return errors.New("no dependencies to bundle")
+	}
+	dir, err := ioutil.TempDir("", "govend-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	a := &vcs.Archive{Dir: dir}
+	for _, dep := range vend.OwnDeps(manifest.Deps) {
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return err
+		}
+		if a.Exists(rr.Root, dep.Rev) {
+			continue
+		}
+		ws, err := c.Checkout(rr, dep.Rev)
+		if err != nil {
+			return err
+		}
+		log.Printf("bundling %s %s", rr.Root, dep.Rev)
+		if err := a.Add(rr.Root, dep.Rev, cache.PackageDir(ws, rr.Root)); err != nil {
+			return err
+		}
+	}
+	return a.Save(path)
+}
@@ -0,0 +1,312 @@
+// Package cache maintains bare clones of dependency repositories,
+// so govend can resolve and check out revisions without using or
+// modifying the repositories in the user's GOPATH.
+//
+// The layout of a cache directory is
+//
+//	repo/<root>              bare clone of the repo for import path root
+//	work/<rev>/src/<root>    files of revision rev of that repo
+//
+// Each work/<rev> directory is a workspace in the sense of GOPATH,
+// and is never modified once written.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/semver"
+	"github.com/azylman/govend/vcs"
+)
+
+// A Cache is a directory of repositories.
+type Cache struct {
+	Dir string
+
+	fetched map[string]bool // repo roots fetched by this process
+}
+
+// DefaultDir returns the cache directory named by $GOVEND_CACHE,
+// or $HOME/.govend/cache if that is not set.
+func DefaultDir() string {
+	if dir := os.Getenv("GOVEND_CACHE"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".govend", "cache")
+}
+
+// PackageDir returns the directory of importPath in workspace.
+func PackageDir(workspace, importPath string) string {
+	return filepath.Join(workspace, "src", filepath.FromSlash(importPath))
+}
+
+func (c *Cache) repoDir(rr *vcs.RepoRoot) string {
+	return filepath.Join(c.Dir, "repo", filepath.FromSlash(rr.Root))
+}
+
+// Fetch makes sure the cache has an up to date clone of rr, and
+// returns its directory. Each repo is fetched at most once by a Cache.
+func (c *Cache) Fetch(rr *vcs.RepoRoot) (string, error) {
+	dir := c.repoDir(rr)
+	if c.fetched[rr.Root] {
+		return dir, nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.Printf("cloning %s from %s", rr.Root, rr.Repo)
+		if err := rr.VCS.CreateBare(dir, rr.Repo); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	} else if err := rr.VCS.Fetch(dir); err != nil {
+		return "", err
+	}
+	if c.fetched == nil {
+		c.fetched = make(map[string]bool)
+	}
+	c.fetched[rr.Root] = true
+	return dir, nil
+}
+
+// Head returns the revision at the tip of rr's default branch.
+func (c *Cache) Head(rr *vcs.RepoRoot) (string, error) {
+	dir, err := c.Fetch(rr)
+	if err != nil {
+		return "", err
+	}
+	return rr.VCS.Head(dir)
+}
+
+// Checkout returns a workspace holding revision rev of rr,
+// fetching the repo first if it doesn't have rev yet.
+func (c *Cache) Checkout(rr *vcs.RepoRoot, rev string) (workspace string, err error) {
+	if rev == "" {
+		return "", errors.New(rr.Root + ": no revision to check out")
+	}
+	workspace = filepath.Join(c.Dir, "work", rev)
+	dst := PackageDir(workspace, rr.Root)
+	if _, err := os.Stat(dst); err == nil {
+		return workspace, nil
+	}
+	dir := c.repoDir(rr)
+	if _, err := os.Stat(dir); os.IsNotExist(err) || !rr.VCS.Exists(dir, rev) {
+		delete(c.fetched, rr.Root) // rev may be newer than our last fetch
+		if dir, err = c.Fetch(rr); err != nil {
+			return "", err
+		}
+	}
+	// Export to a temporary directory first, so a
+	// failed export doesn't leave a partial tree behind.
+	tmp := dst + ".tmp"
+	os.RemoveAll(tmp)
+	if err := rr.VCS.Export(dir, rev, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("%s: exporting %s: %v", rr.Root, rev, err)
+	}
+	return workspace, os.Rename(tmp, dst)
+}
+
+// Describe returns the output of VCS.Describe for rev of rr.
+func (c *Cache) Describe(rr *vcs.RepoRoot, rev string) string {
+	return rr.VCS.Describe(c.repoDir(rr), rev)
+}
+
+// CheckoutDeps points the Workspace, Dir and Root of each of deps at
+// a cache workspace holding its recorded revision, so its source can
+// be copied from there.
+func (c *Cache) CheckoutDeps(deps []pkgs.Dependency) error {
+	for i := range deps {
+		dep := &deps[i]
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return err
+		}
+		ws, err := c.Checkout(rr, dep.Rev)
+		if err != nil {
+			return err
+		}
+		if err := setWorkspace(dep, rr, ws); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckoutRevs moves each of deps to its Rev, which may be any name
+// its repo's VCS understands, such as a tag, fetching from upstream
+// if need be. It records the revision ID in Rev and points the
+// dependency at a cache workspace holding it.
+func (c *Cache) CheckoutRevs(deps []pkgs.Dependency) error {
+	for i := range deps {
+		dep := &deps[i]
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return err
+		}
+		dir, err := c.Fetch(rr)
+		if err != nil {
+			return err
+		}
+		rev, err := rr.VCS.Resolve(dir, dep.Rev)
+		if err != nil {
+			return fmt.Errorf("%s: unknown revision %s", dep.ImportPath, dep.Rev)
+		}
+		ws, err := c.Checkout(rr, rev)
+		if err != nil {
+			return err
+		}
+		dep.Rev = rev
+		dep.Comment = c.Describe(rr, rev)
+		if err := setWorkspace(dep, rr, ws); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update moves each of deps to the tip of its repo's default branch,
+// fetching from upstream, and points it at a cache workspace holding
+// that revision. Packages from the same repo are moved together.
+//
+// If constraint is not nil, deps are instead moved to the highest
+// semver tag of their repo satisfying constraint(dep.ImportPath),
+// which is recorded in dep.Tag.
+func (c *Cache) Update(deps []pkgs.Dependency, constraint func(importPath string) *semver.Constraint) ([]pkgs.Dependency, error) {
+	var updated []pkgs.Dependency
+	for _, dep := range deps {
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return nil, err
+		}
+		var rev string
+		if constraint != nil {
+			rev, dep.Tag, err = c.highestTag(rr, constraint(dep.ImportPath))
+		} else {
+			rev, err = c.Head(rr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ws, err := c.Checkout(rr, rev)
+		if err != nil {
+			return nil, err
+		}
+		dep.Rev = rev
+		dep.Comment = c.Describe(rr, rev)
+		if err := setWorkspace(&dep, rr, ws); err != nil {
+			return nil, err
+		}
+		updated = append(updated, dep)
+	}
+	return updated, nil
+}
+
+// ListDeps lists the dependencies of the named packages, in the
+// current directory's workspace, as pkgs.ListDeps does, but looks
+// for those neither vendored nor in that workspace in the cache, so
+// the rest of GOPATH is not used. A repo in manifest is checked out
+// at its recorded revision, and any other at the tip of its default
+// branch. Repos are fetched from source(importPath) or else the
+// Source recorded in manifest, if either is set.
+func (c *Cache) ListDeps(manifest []pkgs.Dependency, source func(importPath string) string, ignore pkgs.Patterns, name ...string) ([]pkgs.Dependency, error) {
+	ws, err := pkgs.Workspace(".")
+	if err != nil {
+		return nil, err
+	}
+	l := &pkgs.Lister{GOPATH: ws, Manifest: manifest}
+	for {
+		deps, err := l.ListDeps(ignore, name...)
+		var errs pkgs.Errors
+		if err == nil || !errors.As(err, &errs) {
+			return deps, err
+		}
+		found := false
+		for _, perr := range errs {
+			if perr.Phase != pkgs.PhaseList || !strings.Contains(perr.Err.Error(), "cannot find package") {
+				return nil, err
+			}
+			co, ok, cerr := c.checkoutMissing(l.Checkouts, manifest, source, perr.ImportPath)
+			if cerr != nil {
+				return nil, cerr
+			}
+			if ok {
+				l.Checkouts = append(l.Checkouts, co)
+				l.GOPATH += string(filepath.ListSeparator) + co.Workspace
+				found = true
+			}
+		}
+		if !found {
+			return nil, err
+		}
+	}
+}
+
+// checkoutMissing checks out the repo holding importPath, as for
+// ListDeps, unless it is already one of checkouts.
+func (c *Cache) checkoutMissing(checkouts, manifest []pkgs.Dependency, source func(string) string, importPath string) (pkgs.Dependency, bool, error) {
+	src := source(importPath)
+	rr, err := vcs.RepoRootForImportPath(importPath, src)
+	if err != nil {
+		return pkgs.Dependency{}, false, err
+	}
+	var rev string
+	for _, dep := range manifest {
+		if dep.ImportPath == rr.Root || strings.HasPrefix(dep.ImportPath, rr.Root+"/") {
+			rev = dep.Rev
+			if src == "" && dep.Source != "" {
+				src = dep.Source
+				if rr, err = vcs.RepoRootForImportPath(importPath, src); err != nil {
+					return pkgs.Dependency{}, false, err
+				}
+			}
+			break
+		}
+	}
+	for _, co := range checkouts {
+		if co.Root == rr.Root {
+			return pkgs.Dependency{}, false, nil
+		}
+	}
+	if rev == "" {
+		if rev, err = c.Head(rr); err != nil {
+			return pkgs.Dependency{}, false, err
+		}
+	}
+	ws, err := c.Checkout(rr, rev)
+	if err != nil {
+		return pkgs.Dependency{}, false, err
+	}
+	co := pkgs.Dependency{
+		ImportPath: rr.Root,
+		Rev:        rev,
+		Comment:    c.Describe(rr, rev),
+		Source:     src,
+		Workspace:  ws,
+		Root:       rr.Root,
+	}
+	return co, true, nil
+}
+
+func (c *Cache) highestTag(rr *vcs.RepoRoot, con *semver.Constraint) (rev, tag string, err error) {
+	dir, err := c.Fetch(rr)
+	if err != nil {
+		return "", "", err
+	}
+	tag, rev, err = rr.VCS.HighestTag(dir, con)
+	return rev, tag, err
+}
+
+func setWorkspace(dep *pkgs.Dependency, rr *vcs.RepoRoot, ws string) error {
+	dir := PackageDir(ws, dep.ImportPath)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("%s: package not found at %s", dep.ImportPath, dep.Rev)
+	}
+	dep.Workspace = ws
+	dep.Dir = dir
+	dep.Root = rr.Root
+	return nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azylman/govend/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "upstream")
+	commit := func(body string) string {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(upstream, "r.go"), []byte(body), 0666))
+		git(t, upstream, "add", ".")
+		git(t, upstream, "commit", "-q", "-m", body)
+		return git(t, upstream, "rev-parse", "HEAD")
+	}
+	assert.Nil(t, os.MkdirAll(upstream, 0777))
+	git(t, upstream, "init", "-q")
+	rev1 := commit("package r // 1\n")
+	git(t, upstream, "tag", "v1.0.0")
+
+	rr := &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: upstream, Root: "example.com/r"}
+	c := &Cache{Dir: filepath.Join(tmp, "cache")}
+	head, err := c.Head(rr)
+	assert.Nil(t, err)
+	assert.Equal(t, rev1, head)
+	assert.Equal(t, "v1.0.0", c.Describe(rr, head))
+
+	rev2 := commit("package r // 2\n")
+
+	// The cache fetches each repo only once.
+	head, err = c.Head(rr)
+	assert.Nil(t, err)
+	assert.Equal(t, rev1, head)
+
+	// Checking out an unknown revision fetches it.
+	ws, err := c.Checkout(rr, rev2)
+	assert.Nil(t, err)
+	assertFile(t, filepath.Join(ws, "src", "example.com", "r", "r.go"), "package r // 2\n")
+
+	c = &Cache{Dir: c.Dir}
+	head, err = c.Head(rr)
+	assert.Nil(t, err)
+	assert.Equal(t, rev2, head)
+
+	ws, err = c.Checkout(rr, rev1)
+	assert.Nil(t, err)
+	assertFile(t, filepath.Join(ws, "src", "example.com", "r", "r.go"), "package r // 1\n")
+}
+
+func TestListDeps(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	// Two upstream repos, neither of which is in GOPATH.
+	repos := make(map[string]string) // import path → URL
+	heads := make(map[string]string)
+	for _, r := range []struct{ path, body string }{
+		{"github.com/x/d", "package d\n\nimport _ \"github.com/x/e\"\n"},
+		{"github.com/x/e", "package e\n"},
+	} {
+		dir := filepath.Join(tmp, "upstream", filepath.Base(r.path))
+		assert.Nil(t, os.MkdirAll(dir, 0777))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "r.go"), []byte(r.body), 0666))
+		git(t, dir, "init", "-q")
+		git(t, dir, "add", ".")
+		git(t, dir, "commit", "-q", "-m", "initial")
+		repos[r.path] = "file://" + dir
+		heads[r.path] = git(t, dir, "rev-parse", "HEAD")
+	}
+	proj := filepath.Join(tmp, "gopath", "src", "C")
+	assert.Nil(t, os.MkdirAll(proj, 0777))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(proj, "main.go"), []byte("package main\n\nimport _ \"github.com/x/d\"\n\nfunc main() {}\n"), 0666))
+	git(t, proj, "init", "-q")
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	defer os.Chdir(wd)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	assert.Nil(t, os.Setenv("GOPATH", filepath.Join(tmp, "gopath")))
+	assert.Nil(t, os.Chdir(proj))
+
+	c := &Cache{Dir: filepath.Join(tmp, "cache")}
+	source := func(importPath string) string { return repos[importPath] }
+	deps, err := c.ListDeps(nil, source, nil, ".")
+	assert.Nil(t, err)
+	if assert.Len(t, deps, 2) {
+		for _, dep := range deps {
+			assert.Equal(t, heads[dep.ImportPath], dep.Rev, dep.ImportPath)
+			assert.Equal(t, dep.ImportPath, dep.Root)
+			assert.Equal(t, repos[dep.ImportPath], dep.Source)
+			assertFile(t, filepath.Join(dep.Dir, "r.go"), map[string]string{
+				"github.com/x/d": "package d\n\nimport _ \"github.com/x/e\"\n",
+				"github.com/x/e": "package e\n",
+			}[dep.ImportPath])
+		}
+	}
+}
+
+func assertFile(t *testing.T, path, want string) {
+	body, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, want, string(body))
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -5,29 +5,254 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/vend"
 )
 
+// A Command is a govend subcommand, run as
+// "govend name [flags] [args]". Running govend
+// without a command saves dependencies.
+type Command struct {
+	Name  string
+	Args  string // Synopsis of the arguments, e.g. "[packages]".
+	Short string // One-line description.
+	Flag  flag.FlagSet
+	Run   func(cmd *Command, args []string) error
+}
+
+func (c *Command) usage() {
+	fmt.Fprintf(os.Stderr, "usage: govend %s [flags] %s\n\n%s.\n\n", c.Name, c.Args, c.Short)
+	c.Flag.PrintDefaults()
+	os.Exit(2)
+}
+
+var commands = []*Command{
+	cmdAudit,
+	cmdBundle,
+	cmdOutdated,
+	cmdOverlap,
+	cmdRestore,
+	cmdSBOM,
+	cmdUnrewrite,
+	cmdVerify,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: govend [flags] [packages]\n       govend command [flags] [args]\n\nflags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-10s %s\n", cmd.Name, cmd.Short)
+	}
+	os.Exit(2)
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		for _, cmd := range commands {
+			if cmd.Name != os.Args[1] {
+				continue
+			}
+			cmd.Flag.Usage = cmd.usage
+			cmd.Flag.Parse(os.Args[2:])
+			if err := cmd.Run(cmd, cmd.Flag.Args()); err != nil {
+				fmt.Fprintf(os.Stderr, "govend %s: %s\n", cmd.Name, err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	updateExisting := flag.Bool("u", false, "update existing packages")
+	tags := flag.Bool("tags", false, "with -u, update to the highest semver tag instead of the latest commit")
+	version := flag.String("version", "", "with -u -tags, only consider tags satisfying `constraint`, e.g. ^1.2")
 	noGet := flag.Bool("no-get", false, "do not run go get")
+	var ignore stringList
+	flag.Var(&ignore, "ignore", "comma-separated `patterns` of packages not to vendor")
+	var unignore stringList
+	flag.Var(&unignore, "unignore", "comma-separated `patterns` to remove from the ignore list")
+	useCache := flag.Bool("cache", false, "fetch dependencies into a private cache instead of GOPATH")
+	cacheDir := flag.String("cache-dir", cache.DefaultDir(), "`directory` of the private cache")
+	stripNested := flag.Bool("strip-nested", false, "delete nested vendor copies of packages that are vendored at the top level")
+	flatten := flag.Bool("flatten", false, "hoist packages in nested vendor directories into the top-level one")
+	var importComments vend.ImportCommentMode
+	flag.Var(&importComments, "import-comments", "what to do with import comments of vendored files: strip, keep or rewrite")
+	rewrite := flag.Bool("r", false, "rewrite imports of vendored packages to their fully-qualified vendor/ path")
+	changelog := flag.String("changelog", "", "with -u, write a Markdown changelog of the updated repos to `file`, or - for standard output")
+	jsonOut := flag.Bool("json", false, "print a JSON report of the dependencies added, removed and updated")
+	allowDirty := flag.Bool("allow-dirty", false, "record dependencies with uncommitted changes, untracked files or unpushed commits, with a warning")
+	profile := flag.String("profile", "", "save the packages of the `profile` named in Govend.toml into its vendor directory")
+	flag.Usage = usage
 	flag.Parse()
 
-	if !*noGet {
-		args := append([]string{"get"}, os.Args[1:]...)
-		if out, err := exec.Command("go", args...).Output(); err != nil {
-			fmt.Fprintf(os.Stderr, "error running go get: %s, %s", err.Error(), out)
+	args, vendor := flag.Args(), vend.VendorDir
+	deps := args // Patterns of the dependencies -u updates.
+	if *updateExisting {
+		var err error
+		if args, err = packageArgs(args); err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err.Error())
 			os.Exit(1)
 		}
 	}
 
-	if err := save(flag.Args()); err != nil {
-		fmt.Fprintf(os.Stderr, "error adding new dependencies: %s", err.Error())
+	var packages []string // Whose dependencies -u keeps, if not ./...
+	if *profile != "" {
+		p, err := lookupProfile(*profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading profile: %s\n", err.Error())
+			os.Exit(1)
+		}
+		vendor = p.Vendor
+		packages = p.Packages
+		if len(args) == 0 {
+			args = p.Packages
+		}
+	}
+
+	var c *cache.Cache
+	if *useCache {
+		c = &cache.Cache{Dir: *cacheDir}
+	}
+
+	if c == nil && (!*noGet || *updateExisting) {
+		// Save lists the packages in the manifest, so those missing
+		// from GOPATH, as on a fresh machine, must be fetched first,
+		// from their Source if set; go get would fetch them upstream.
+		// Saving again checks out the revisions recorded.
+		manifest, err := vend.CurrentManifest(vendor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading manifest: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if err := pkgs.FetchMissing(manifest.Deps, !*updateExisting); err != nil {
+			fmt.Fprintf(os.Stderr, "error fetching dependencies: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if !*noGet && c == nil {
+		getArgs := []string{"get"}
+		if *updateExisting && !*tags {
+			getArgs = append(getArgs, "-u")
+		}
+		getArgs = append(getArgs, args...)
+		if out, err := exec.Command("go", getArgs...).Output(); err != nil {
+			fmt.Fprintf(os.Stderr, "error running go get: %s, %s\n", err.Error(), out)
+			os.Exit(1)
+		}
+	}
+
+	opts := vend.SaveOptions{
+		Packages:       args,
+		Ignore:         ignore,
+		Unignore:       unignore,
+		Cache:          c,
+		StripNested:    *stripNested,
+		Flatten:        *flatten,
+		ImportComments: importComments,
+		Rewrite:        *rewrite,
+		Vendor:         vendor,
+		AllowDirty:     *allowDirty,
+	}
+	saved, err := vend.Save(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error adding new dependencies: %s\n", err.Error())
 		os.Exit(1)
 	}
+	warnUnparsed(saved.Unparsed)
+	report := saved.Report
 	if *updateExisting {
-		if err := update(flag.Args()); err != nil {
-			fmt.Fprintf(os.Stderr, "error adding new dependencies: %s", err.Error())
+		opts := vend.UpdateOptions{
+			Deps:           deps,
+			Packages:       packages,
+			Cache:          c,
+			Tags:           *tags,
+			Version:        *version,
+			ImportComments: importComments,
+			Rewrite:        *rewrite,
+			Vendor:         vendor,
+			Changelog:      *changelog != "",
+			AllowDirty:     *allowDirty,
+		}
+		updated, err := vend.Update(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error adding new dependencies: %s\n", err.Error())
+			os.Exit(1)
+		}
+		warnUnparsed(updated.Unparsed)
+		report.Merge(updated.Report)
+		if *changelog != "" {
+			if err := writeChangelog(*changelog, updated.Changelog); err != nil {
+				fmt.Fprintf(os.Stderr, "error writing changelog: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+	if *jsonOut {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			fmt.Fprintf(os.Stderr, "error writing report: %s\n", err.Error())
 			os.Exit(1)
 		}
 	}
 }
+
+// stringList is a flag.Value that accumulates
+// comma-separated values across repeated flags.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// writeChangelog writes logs as Markdown to the file name,
+// or to standard output if name is "-".
+func writeChangelog(name string, logs []vend.RepoLog) error {
+	if name == "-" {
+		return vend.WriteChangelog(os.Stdout, logs)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := vend.WriteChangelog(f, logs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// warnUnparsed reports the Go files copied without their import
+// comments handled, as their package clause couldn't be parsed.
+func warnUnparsed(errs pkgs.Errors) {
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+	}
+}
+
+// packageArgs returns the packages to fetch and save for the
+// dependency patterns given to -u: those that aren't negated,
+// without their revisions.
+func packageArgs(args []string) ([]string, error) {
+	pats, err := pkgs.ParsePatterns(args)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, p := range pats {
+		if !p.Negate {
+			paths = append(paths, p.Path)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/vcs"
+	"github.com/azylman/govend/vend"
+)
+
+var cmdOutdated = &Command{
+	Name:  "outdated",
+	Short: "list dependencies with newer commits or tags upstream",
+	Run:   runOutdated,
+}
+
+var (
+	outdatedJSON     bool
+	outdatedGOPATH   bool
+	outdatedCacheDir string
+)
+
+func init() {
+	cmdOutdated.Flag.BoolVar(&outdatedJSON, "json", false, "print the report as JSON")
+	cmdOutdated.Flag.BoolVar(&outdatedGOPATH, "gopath", false, "compare with the repos checked out in GOPATH instead of fetching them")
+	cmdOutdated.Flag.StringVar(&outdatedCacheDir, "cache-dir", cache.DefaultDir(), "`directory` of the private cache")
+}
+
+// An outdatedRepo describes how far a vendored
+// repo is behind the tip of its default branch.
+type outdatedRepo struct {
+	Root        string
+	ImportPaths []string
+	Rev         string
+	Comment     string `json:",omitempty"`
+	Head        string
+	Commits     int      // Commits between Rev and Head.
+	NewTags     []string `json:",omitempty"` // Tags on those commits, newest first.
+	Untagged    int      // Commits newer than the newest tag.
+	Skipped     string   `json:",omitempty"` // Why the repo couldn't be checked, if it couldn't.
+}
+
+func runOutdated(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	var c *cache.Cache
+	if !outdatedGOPATH {
+		c = &cache.Cache{Dir: outdatedCacheDir}
+	}
+	repos, err := outdated(c)
+	if err != nil {
+		return err
+	}
+	if outdatedJSON {
+		return writeJSON(os.Stdout, repos)
+	}
+	return writeOutdated(os.Stdout, repos)
+}
+
+// outdated fetches the repo of each dependency in the manifest
+// into c, or finds it in GOPATH if c is nil, and reports those
+// with commits after the recorded rev. Repos whose VCS can't
+// tell, or that aren't in GOPATH, are reported as skipped.
+func outdated(c *cache.Cache) ([]outdatedRepo, error) {
+	manifest, err := vend.CurrentManifest(vend.VendorDir)
+	if err != nil {
+		return nil, err
+	}
+	repos := []outdatedRepo{}
+	byRoot := make(map[string]int) // index in repos
+	for _, dep := range vend.OwnDeps(manifest.Deps) {
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := byRoot[rr.Root]; ok {
+			if i >= 0 {
+				repos[i].ImportPaths = append(repos[i].ImportPaths, dep.ImportPath)
+			}
+			continue
+		}
+		repo, err := checkOutdated(c, rr, dep.Rev)
+		if errors.Is(err, vcs.ErrUnsupported) || errors.Is(err, errNotInGOPATH) {
+			repo.Skipped = err.Error()
+		} else if err != nil {
+			return nil, err
+		}
+		if repo.Commits == 0 && repo.Skipped == "" {
+			byRoot[rr.Root] = -1 // Up to date.
+			continue
+		}
+		repo.ImportPaths = []string{dep.ImportPath}
+		repo.Comment = dep.Comment
+		byRoot[rr.Root] = len(repos)
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+var errNotInGOPATH = errors.New("not in GOPATH")
+
+// checkOutdated compares rev with the tip of the default branch of
+// the repo rr, fetched into c, or with the revision checked out in
+// GOPATH if c is nil.
+func checkOutdated(c *cache.Cache, rr *vcs.RepoRoot, rev string) (outdatedRepo, error) {
+	repo := outdatedRepo{Root: rr.Root, Rev: rev}
+	v := rr.VCS
+	var dir string
+	var err error
+	if c != nil {
+		if dir, err = c.Fetch(rr); err != nil {
+			return repo, err
+		}
+		repo.Head, err = v.Head(dir)
+	} else {
+		if dir, v, err = gopathRepo(rr.Root); err != nil {
+			return repo, err
+		}
+		repo.Head, err = v.Identify(dir)
+	}
+	if err != nil {
+		return repo, err
+	}
+	commits, err := v.Log(dir, rev, repo.Head)
+	if err != nil {
+		return repo, err
+	}
+	tags, err := v.Tags(dir)
+	if err != nil {
+		return repo, err
+	}
+	repo.Commits = len(commits)
+	for _, commit := range commits {
+		t := tags[commit.Rev]
+		if len(t) == 0 && len(repo.NewTags) == 0 {
+			repo.Untagged++
+		}
+		sort.Strings(t)
+		repo.NewTags = append(repo.NewTags, t...)
+	}
+	return repo, nil
+}
+
+// gopathRepo returns the directory of the repo with import path
+// root in the first GOPATH workspace that has it, and its VCS.
+func gopathRepo(root string) (string, *vcs.VCS, error) {
+	for _, ws := range filepath.SplitList(build.Default.GOPATH) {
+		srcRoot := filepath.Join(ws, "src")
+		dir := filepath.Join(srcRoot, filepath.FromSlash(root))
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		v, _, err := vcs.FromDir(dir, srcRoot)
+		return dir, v, err
+	}
+	return "", nil, errNotInGOPATH
+}
+
+func writeOutdated(w io.Writer, repos []outdatedRepo) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tREV\tCOMMITS\tNEW TAGS\tUNTAGGED")
+	for _, r := range repos {
+		rev := r.Comment
+		if rev == "" {
+			rev = shortRev(r.Rev)
+		}
+		if r.Skipped != "" {
+			fmt.Fprintf(tw, "%s\t%s\t-\t(%s)\t-\n", r.Root, rev, r.Skipped)
+			continue
+		}
+		tags := strings.Join(r.NewTags, ", ")
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\n", r.Root, rev, r.Commits, tags, r.Untagged)
+	}
+	return tw.Flush()
+}
+
+// shortRev abbreviates a revision ID for display.
+func shortRev(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckOutdated(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	upstream := filepath.Join(tmp, "D")
+	assert.Nil(t, os.MkdirAll(upstream, 0777))
+	git(t, upstream, "init", "-q")
+	for i, tag := range []string{"v1.0.0", "v1.1.0", "", ""} {
+		body := "package D\nvar D" + strconv.Itoa(i+1) + " int\n"
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(upstream, "main.go"), []byte(body), 0666))
+		git(t, upstream, "add", ".")
+		git(t, upstream, "commit", "-q", "-m", body)
+		if tag != "" {
+			git(t, upstream, "tag", tag)
+		}
+	}
+	rev := git(t, upstream, "rev-parse", "v1.0.0")
+
+	rr := &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: upstream, Root: "D"}
+	repo, err := checkOutdated(&cache.Cache{Dir: filepath.Join(tmp, "cache")}, rr, rev)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, repo.Commits)
+	assert.Equal(t, []string{"v1.1.0"}, repo.NewTags)
+	assert.Equal(t, 2, repo.Untagged)
+
+	gopath := filepath.Join(tmp, "gopath")
+	defer func(old string) { build.Default.GOPATH = old }(build.Default.GOPATH)
+	build.Default.GOPATH = gopath
+	_, err = checkOutdated(nil, rr, rev)
+	assert.True(t, errors.Is(err, errNotInGOPATH))
+
+	checkout := filepath.Join(gopath, "src", "D")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(checkout), 0777))
+	git(t, tmp, "clone", "-q", upstream, checkout)
+	git(t, checkout, "checkout", "-q", "v1.1.0")
+	repo, err = checkOutdated(nil, rr, rev)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, repo.Commits)
+	assert.Equal(t, []string{"v1.1.0"}, repo.NewTags)
+	assert.Equal(t, 0, repo.Untagged)
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
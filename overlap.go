@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/azylman/govend/vend"
+)
+
+var cmdOverlap = &Command{
+	Name:  "overlap",
+	Short: "list dependencies vendored by more than one profile",
+	Run:   runOverlap,
+}
+
+var overlapJSON bool
+
+func init() {
+	cmdOverlap.Flag.BoolVar(&overlapJSON, "json", false, "print the report as JSON")
+}
+
+// An overlapDep is a dependency vendored by several profiles.
+type overlapDep struct {
+	ImportPath string
+	Profiles   []profileRev
+	Conflict   bool // The profiles pin different revisions.
+}
+
+// A profileRev is the revision a profile pins a dependency at.
+type profileRev struct {
+	Profile string
+	Rev     string
+	Comment string `json:",omitempty"`
+}
+
+func runOverlap(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	cons, err := vend.ReadConstraints(vend.ConstraintsFile)
+	if err != nil {
+		return err
+	}
+	if len(cons.Profile) == 0 {
+		return errors.New("no profiles in " + vend.ConstraintsFile)
+	}
+	deps, err := overlap(cons.Profile)
+	if err != nil {
+		return err
+	}
+	if overlapJSON {
+		return writeJSON(os.Stdout, deps)
+	}
+	return writeOverlap(os.Stdout, deps)
+}
+
+// lookupProfile returns the profile called name in the constraints file.
+func lookupProfile(name string) (*vend.Profile, error) {
+	cons, err := vend.ReadConstraints(vend.ConstraintsFile)
+	if err != nil {
+		return nil, err
+	}
+	return cons.LookupProfile(name)
+}
+
+// overlap reads the manifest of each of profiles and returns the
+// dependencies found in more than one, sorted by import path.
+func overlap(profiles []vend.Profile) ([]overlapDep, error) {
+	byPath := make(map[string][]profileRev)
+	for _, p := range profiles {
+		manifest, err := vend.CurrentManifest(p.Vendor)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", p.Name, err)
+		}
+		if len(manifest.Deps) == 0 {
+			log.Printf("profile %s has no dependencies saved", p.Name)
+		}
+		for _, dep := range manifest.Deps {
+			byPath[dep.ImportPath] = append(byPath[dep.ImportPath], profileRev{p.Name, dep.Rev, dep.Comment})
+		}
+	}
+	var paths []string
+	for importPath, revs := range byPath {
+		if len(revs) > 1 {
+			paths = append(paths, importPath)
+		}
+	}
+	sort.Strings(paths)
+	deps := []overlapDep{}
+	for _, importPath := range paths {
+		revs := byPath[importPath]
+		d := overlapDep{ImportPath: importPath, Profiles: revs}
+		for _, r := range revs {
+			if r.Rev != revs[0].Rev {
+				d.Conflict = true
+			}
+		}
+		deps = append(deps, d)
+	}
+	return deps, nil
+}
+
+func writeOverlap(w io.Writer, deps []overlapDep) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMPORT PATH\tPROFILES\tREVS")
+	for _, d := range deps {
+		var names, revs []string
+		for _, r := range d.Profiles {
+			names = append(names, r.Profile)
+			rev := r.Comment
+			if rev == "" {
+				rev = shortRev(r.Rev)
+			}
+			revs = append(revs, rev)
+		}
+		if !d.Conflict {
+			revs = revs[:1]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.ImportPath, strings.Join(names, ", "), strings.Join(revs, ", "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/vend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlap(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	manifests := map[string]string{
+		"api": `{"ImportPath": "C", "Deps": [{"ImportPath": "D", "Rev": "d1"}, {"ImportPath": "E", "Rev": "e1"}]}`,
+		"web": `{"ImportPath": "C", "Deps": [{"ImportPath": "D", "Rev": "d1"}, {"ImportPath": "E", "Rev": "e2"}, {"ImportPath": "F", "Rev": "f1"}]}`,
+		"cli": `{"ImportPath": "C", "Deps": [{"ImportPath": "G", "Rev": "g1"}]}`,
+	}
+	var profiles []vend.Profile
+	for _, name := range []string{"api", "web", "cli"} {
+		vendor := filepath.Join(tmp, name, "vendor")
+		assert.Nil(t, writeFile(filepath.Join(vendor, "Deps.json"), manifests[name]))
+		profiles = append(profiles, vend.Profile{Name: name, Vendor: vendor})
+	}
+
+	deps, err := overlap(profiles)
+	assert.Nil(t, err)
+	assert.Equal(t, []overlapDep{
+		{ImportPath: "D", Profiles: []profileRev{{"api", "d1", ""}, {"web", "d1", ""}}},
+		{ImportPath: "E", Profiles: []profileRev{{"api", "e1", ""}, {"web", "e2", ""}}, Conflict: true},
+	}, deps)
+}
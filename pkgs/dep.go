@@ -2,87 +2,176 @@ package pkgs
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/azylman/govend/semver"
 	"github.com/azylman/govend/vcs"
 )
 
 const srcdir = "vendor"
 const sep = "/" + srcdir + "/"
 
-func ListDeps(name ...string) ([]Dependency, error) {
+// ListDeps returns the dependencies of the named packages, along
+// with the dependencies of their tests. Packages matching ignore
+// are skipped.
+func ListDeps(ignore Patterns, name ...string) ([]Dependency, error) {
+	return new(Lister).ListDeps(ignore, name...)
+}
+
+// A Lister lists dependencies, as ListDeps does, but can look for
+// them outside GOPATH, such as in a cache.
+type Lister struct {
+	// GOPATH, if not empty, is the list of workspaces to look
+	// for packages in, rather than $GOPATH.
+	GOPATH string
+
+	// Checkouts are repos checked out, at their Rev, in their
+	// Workspace, which need not be a VCS checkout. Packages
+	// found in them get their Root, Rev, Comment and Source.
+	Checkouts []Dependency
+
+	// Manifest holds the dependencies already recorded. Those
+	// hoisted out of nested vendor directories, with VendoredBy
+	// set, live only in the vendor tree, so they are listed as
+	// recorded rather than looked for in GOPATH.
+	Manifest []Dependency
+}
+
+// hoisted returns the dependency in l.Manifest hoisted
+// out of a nested vendor directory holding importPath, if any.
+func (l *Lister) hoisted(importPath string) (Dependency, bool) {
+	for _, dep := range l.Manifest {
+		if dep.VendoredBy != "" && containsPathPrefix([]string{dep.ImportPath}, importPath) {
+			return dep, true
+		}
+	}
+	return Dependency{}, false
+}
+
+// checkout returns the checkout holding pkg, if any.
+func (l *Lister) checkout(pkg *pack) (Dependency, bool) {
+	for _, co := range l.Checkouts {
+		if filepath.Clean(co.Workspace) == filepath.Clean(pkg.Root) && containsPathPrefix([]string{co.Root}, pkg.ImportPath) {
+			return co, true
+		}
+	}
+	return Dependency{}, false
+}
+
+// ListDeps is like the function ListDeps.
+func (l *Lister) ListDeps(ignore Patterns, name ...string) ([]Dependency, error) {
 	deps := []Dependency{}
-	pkgs, err := loadPacks(name...)
+	pkgs, err := loadPacksIn(l.GOPATH, name...)
 	if err != nil {
 		return deps, err
 	}
-	var err1 error
-	var path, seen []string
+	var errs Errors
+	var path, seen, imports []string
 	for _, p := range pkgs {
 		if p.Standard {
 			log.Println("ignoring stdlib package:", p.ImportPath)
 			continue
 		}
+		if ignore.Match(p.ImportPath) {
+			log.Println("ignoring package:", p.ImportPath)
+			continue
+		}
 		if p.Error.Err != "" {
-			log.Println(p.Error.Err)
-			err1 = errors.New("error loading packages")
+			errs.Add(p.ImportPath, p.Dir, PhaseList, errors.New(p.Error.Err))
 			continue
 		}
 		_, reporoot, err := vcs.FromDir(p.Dir, filepath.Join(p.Root, "src"))
 		if err != nil {
-			log.Println(err)
-			err1 = errors.New("error loading packages")
+			errs.Add(p.ImportPath, p.Dir, PhaseVCS, err)
 			continue
 		}
 		seen = append(seen, filepath.ToSlash(reporoot))
-		path = append(path, p.Deps...)
+		imports = append(imports, p.Imports...)
 	}
-	var testImports []string
 	for _, p := range pkgs {
-		testImports = append(testImports, p.TestImports...)
-		testImports = append(testImports, p.XTestImports...)
-	}
-	ps, err := loadPacks(testImports...)
-	if err != nil {
-		return deps, err
-	}
-	for _, p := range ps {
-		if p.Standard {
+		if ignore.Match(p.ImportPath) {
 			continue
 		}
-		if p.Error.Err != "" {
-			log.Println(p.Error.Err)
-			err1 = errors.New("error loading packages")
-			continue
-		}
-		path = append(path, p.ImportPath)
-		path = append(path, p.Deps...)
+		imports = append(imports, p.TestImports...)
+		imports = append(imports, p.XTestImports...)
 	}
-	for i, p := range path {
-		path[i] = unqualify(p)
+	// Walk the import graph rather than using the packages' Deps,
+	// so that what only ignored packages import is left out too.
+	walked := make(map[string]bool)
+	hoisted := make(map[string]Dependency) // by import path
+	for len(imports) > 0 {
+		var next []string
+		for _, imp := range imports {
+			if walked[imp] || ignore.Match(Unqualify(imp)) {
+				continue
+			}
+			walked[imp] = true
+			next = append(next, imp)
+			if dep, ok := l.hoisted(Unqualify(imp)); ok {
+				hoisted[dep.ImportPath] = dep
+			} else if !nestedVendored(seen, imp) {
+				// Otherwise it is copied along with the dependency
+				// holding it, and not in GOPATH under its
+				// unqualified path.
+				path = append(path, Unqualify(imp))
+			}
+		}
+		ps, err := loadPacksIn(l.GOPATH, next...)
+		if err != nil {
+			return deps, err
+		}
+		imports = nil
+		for _, p := range ps {
+			if !p.Standard && p.Error.Err == "" {
+				imports = append(imports, p.Imports...)
+			}
+		}
 	}
 	sort.Strings(path)
 	path = uniq(path)
-	ps, err = loadPacks(path...)
+	var hpaths []string
+	for p := range hoisted {
+		hpaths = append(hpaths, p)
+	}
+	sort.Strings(hpaths)
+	for _, p := range hpaths {
+		deps = append(deps, hoisted[p])
+	}
+	ps, err := loadPacksIn(l.GOPATH, path...)
 	if err != nil {
 		return deps, err
 	}
 	for _, pkg := range ps {
 		if pkg.Error.Err != "" {
-			log.Println(pkg.Error.Err)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(pkg.ImportPath, pkg.Dir, PhaseList, errors.New(pkg.Error.Err))
 			continue
 		}
 		if pkg.Standard {
 			continue
 		}
+		if co, ok := l.checkout(pkg); ok {
+			if containsPathPrefix(seen, pkg.ImportPath) {
+				continue
+			}
+			seen = append(seen, pkg.ImportPath)
+			deps = append(deps, Dependency{
+				ImportPath: pkg.ImportPath,
+				Rev:        co.Rev,
+				Comment:    co.Comment,
+				Source:     co.Source,
+				Dir:        pkg.Dir,
+				Workspace:  pkg.Root,
+				Root:       co.Root,
+			})
+			continue
+		}
 		vcs, reporoot, err := vcs.FromDir(pkg.Dir, filepath.Join(pkg.Root, "src"))
 		if err != nil {
-			log.Println(err)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(pkg.ImportPath, pkg.Dir, PhaseVCS, err)
 			continue
 		}
 		if containsPathPrefix(seen, pkg.ImportPath) {
@@ -91,13 +180,7 @@ func ListDeps(name ...string) ([]Dependency, error) {
 		seen = append(seen, pkg.ImportPath)
 		id, err := vcs.Identify(pkg.Dir)
 		if err != nil {
-			log.Println(err)
-			err1 = errors.New("error loading dependencies")
-			continue
-		}
-		if vcs.IsDirty(pkg.Dir, id) {
-			log.Println("dirty working tree:", pkg.Dir)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(pkg.ImportPath, pkg.Dir, PhaseVCS, err)
 			continue
 		}
 		comment := vcs.Describe(pkg.Dir, id)
@@ -111,7 +194,7 @@ func ListDeps(name ...string) ([]Dependency, error) {
 			vcs:        vcs,
 		})
 	}
-	return deps, err1
+	return deps, errs.Err()
 }
 
 // A Dependency is a specific revision of a package.
@@ -119,6 +202,9 @@ type Dependency struct {
 	ImportPath string
 	Comment    string `json:",omitempty"` // Description of commit, if present.
 	Rev        string // VCS-specific commit ID.
+	Source     string `json:",omitempty"` // Alternate location of the repo, if any.
+	Tag        string `json:",omitempty"` // Semver tag Rev was chosen from, if any.
+	VendoredBy string `json:",omitempty"` // Dependency whose vendor directory it was hoisted from, if any.
 
 	// used by command save & update
 	Workspace string `json:"-"` // workspace
@@ -132,6 +218,40 @@ type Dependency struct {
 	vcs *vcs.VCS
 }
 
+// VerifySource checks that the checkout d was loaded from was
+// cloned from d.Source, if d has one, so that a fork recorded in
+// the manifest isn't silently replaced by the upstream repo.
+func (d Dependency) VerifySource() error {
+	if d.Source == "" || d.vcs == nil {
+		return nil
+	}
+	remote, err := d.vcs.Remote(d.Dir)
+	if err != nil {
+		return &PackageError{d.ImportPath, d.Dir, PhaseSource, fmt.Errorf("cannot find remote: %v", err)}
+	}
+	if vcs.SameRepo(remote, d.Source) {
+		return nil
+	}
+	if rr, err := vcs.RepoRootForImportPath(d.ImportPath, d.Source); err == nil && vcs.SameRepo(remote, rr.Repo) {
+		return nil
+	}
+	return &PackageError{d.ImportPath, d.Dir, PhaseSource, fmt.Errorf("cloned from %s, not source %s", remote, d.Source)}
+}
+
+// nestedVendored reports whether importPath is in a vendor directory
+// of a dependency, rather than one of the repos in roots, which hold
+// the packages being vendored.
+func nestedVendored(roots []string, importPath string) bool {
+	i := strings.Index(importPath, sep)
+	if i < 0 {
+		return false
+	}
+	if !containsPathPrefix(roots, importPath[:i]) {
+		return true
+	}
+	return strings.Contains(importPath[i+len(sep):], sep)
+}
+
 // containsPathPrefix returns whether any string in a
 // is s or a directory containing s.
 // For example, pattern ["a"] matches "a" and "a/b"
@@ -158,15 +278,15 @@ func uniq(a []string) []string {
 	return a[:i]
 }
 
-// unqualify returns the part of importPath after the last
+// Unqualify returns the part of importPath after the last
 // occurrence of the signature path elements
 // (vendor) that always precede imported
 // packages in rewritten import paths.
 //
 // For example,
-//   unqualify(C)                         = C
-//   unqualify(D/vendor/C) = C
-func unqualify(importPath string) string {
+//   Unqualify(C)                         = C
+//   Unqualify(D/vendor/C) = C
+func Unqualify(importPath string) string {
 	if i := strings.LastIndex(importPath, sep); i != -1 {
 		importPath = importPath[i+len(sep):]
 	}
@@ -174,7 +294,7 @@ func unqualify(importPath string) string {
 }
 
 func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
-	var err1 error
+	var errs Errors
 	var paths []string
 	for _, dep := range deps {
 		paths = append(paths, dep.ImportPath)
@@ -195,29 +315,30 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
 			}
 		}
 		if dep.pkg == nil {
-			log.Println(dep.ImportPath + ": error listing package")
-			err1 = errors.New("error loading dependencies")
+			errs.Add(dep.ImportPath, "", PhaseList, errors.New("not listed by go list"))
 			continue
 		}
 		if dep.pkg.Error.Err != "" {
-			log.Println(dep.pkg.Error.Err)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(dep.ImportPath, dep.pkg.Dir, PhaseList, errors.New(dep.pkg.Error.Err))
 			continue
 		}
 		vcs, reporoot, err := vcs.FromDir(dep.pkg.Dir, filepath.Join(dep.pkg.Root, "src"))
 		if err != nil {
-			log.Println(err)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(dep.ImportPath, dep.pkg.Dir, PhaseVCS, err)
 			continue
 		}
 		dep.Dir = dep.pkg.Dir
 		dep.Workspace = dep.pkg.Root
 		dep.Root = filepath.ToSlash(reporoot)
 		dep.vcs = vcs
+		if err := dep.VerifySource(); err != nil {
+			errs.Add(dep.ImportPath, dep.Dir, PhaseSource, err)
+			continue
+		}
 		candidates = append(candidates, dep)
 	}
-	if err1 != nil {
-		return nil, err1
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
 	for _, dep := range candidates {
@@ -228,21 +349,278 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
 		}
 		id, err := dep.vcs.Identify(dep.pkg.Dir)
 		if err != nil {
-			log.Println(err)
-			err1 = errors.New("error loading dependencies")
+			errs.Add(dep.ImportPath, dep.Dir, PhaseVCS, err)
 			continue
 		}
-		if dep.vcs.IsDirty(dep.pkg.Dir, id) {
-			log.Println("dirty working tree:", dep.pkg.Dir)
-			err1 = errors.New("error loading dependencies")
-			break
-		}
 		dep.Rev = id
 		dep.Comment = dep.vcs.Describe(dep.pkg.Dir, id)
 		tocopy = append(tocopy, dep)
 	}
-	if err1 != nil {
-		return nil, err1
+	if len(errs) > 0 {
+		return nil, errs
 	}
 	return tocopy, nil
 }
+
+// CheckoutTags checks out, in GOPATH, the highest semver tag of the
+// repo of each of deps that satisfies constraint(dep.ImportPath), and
+// records it in dep.Tag. A nil constraint matches any version. Each
+// repo is checked out once, using the constraint of the first of deps
+// in it. Repos with uncommitted changes are not touched. The repos
+// are left at the tags, off any branch, which is logged.
+func CheckoutTags(deps []Dependency, constraint func(importPath string) *semver.Constraint) error {
+	var paths []string
+	for _, dep := range deps {
+		paths = append(paths, dep.ImportPath)
+	}
+	ps, err := loadPacks(paths...)
+	if err != nil {
+		return err
+	}
+	tags := make(map[string]string) // repo dir → tag
+	for i := range deps {
+		dep := &deps[i]
+		var pkg *pack
+		for _, p := range ps {
+			if p.ImportPath == dep.ImportPath {
+				pkg = p
+				break
+			}
+		}
+		if pkg == nil {
+			return &PackageError{dep.ImportPath, "", PhaseList, errors.New("not listed by go list")}
+		}
+		if pkg.Error.Err != "" {
+			return &PackageError{dep.ImportPath, pkg.Dir, PhaseList, errors.New(pkg.Error.Err)}
+		}
+		srcRoot := filepath.Join(pkg.Root, "src")
+		v, reporoot, err := vcs.FromDir(pkg.Dir, srcRoot)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(srcRoot, reporoot)
+		if tag, ok := tags[dir]; ok {
+			dep.Tag = tag
+			continue
+		}
+		id, err := v.Identify(dir)
+		if err != nil {
+			return err
+		}
+		if err := checkUnmodified(v, dir, id); err != nil {
+			return &PackageError{dep.ImportPath, dir, PhaseVCS, err}
+		}
+		tag, rev, err := v.HighestTag(dir, constraint(dep.ImportPath))
+		if err != nil {
+			return err
+		}
+		if err := v.Checkout(dir, rev); err != nil {
+			return err
+		}
+		if rev != id {
+			log.Printf("checked out %s in %s, which is now off any branch", tag, dir)
+		}
+		tags[dir] = tag
+		dep.Tag = tag
+	}
+	return nil
+}
+
+// CheckoutRevs checks out, in GOPATH, the Rev of the repo of each
+// of deps, which may be any name the repo's VCS understands, such
+// as a tag, and records the revision ID in Rev. Repos with
+// uncommitted changes are not touched. Those checked out are left
+// off any branch, which is logged.
+func CheckoutRevs(deps []Dependency) error {
+	var paths []string
+	for _, dep := range deps {
+		paths = append(paths, dep.ImportPath)
+	}
+	ps, err := loadPacks(paths...)
+	if err != nil {
+		return err
+	}
+	for i := range deps {
+		dep := &deps[i]
+		var pkg *pack
+		for _, p := range ps {
+			if p.ImportPath == dep.ImportPath {
+				pkg = p
+				break
+			}
+		}
+		if pkg == nil {
+			return &PackageError{dep.ImportPath, "", PhaseList, errors.New("not listed by go list")}
+		}
+		if pkg.Error.Err != "" {
+			return &PackageError{dep.ImportPath, pkg.Dir, PhaseList, errors.New(pkg.Error.Err)}
+		}
+		srcRoot := filepath.Join(pkg.Root, "src")
+		v, reporoot, err := vcs.FromDir(pkg.Dir, srcRoot)
+		if err != nil {
+			return &PackageError{dep.ImportPath, pkg.Dir, PhaseVCS, err}
+		}
+		dir := filepath.Join(srcRoot, reporoot)
+		id, err := v.Identify(dir)
+		if err != nil {
+			return &PackageError{dep.ImportPath, dir, PhaseVCS, err}
+		}
+		if id != dep.Rev {
+			if err := checkUnmodified(v, dir, id); err != nil {
+				return &PackageError{dep.ImportPath, dir, PhaseVCS, err}
+			}
+			if err := v.Checkout(dir, dep.Rev); err != nil {
+				return &PackageError{dep.ImportPath, dir, PhaseVCS, fmt.Errorf("checking out %s: %v", dep.Rev, err)}
+			}
+			log.Printf("checked out %s in %s, which is now off any branch", dep.Rev, dir)
+			if id, err = v.Identify(dir); err != nil {
+				return &PackageError{dep.ImportPath, dir, PhaseVCS, err}
+			}
+		}
+		dep.Rev = id
+		dep.Comment = v.Describe(dir, id)
+		dep.Dir = pkg.Dir
+		dep.Workspace = pkg.Root
+		dep.Root = filepath.ToSlash(reporoot)
+		dep.vcs = v
+	}
+	return nil
+}
+
+// VerifySources checks deps read from a manifest, whose Source has
+// changed since, against it: the checkout of each in GOPATH, cloned
+// from the Source if missing, must have been cloned from the Source,
+// as for VerifySource, and have the revision recorded.
+func VerifySources(deps []Dependency) error {
+	if err := FetchMissing(deps, false); err != nil {
+		return err
+	}
+	var paths []string
+	for _, dep := range deps {
+		paths = append(paths, dep.ImportPath)
+	}
+	ps, err := loadPacks(paths...)
+	if err != nil {
+		return err
+	}
+	var errs Errors
+	for _, dep := range deps {
+		var pkg *pack
+		for _, p := range ps {
+			if p.ImportPath == dep.ImportPath {
+				pkg = p
+				break
+			}
+		}
+		if pkg == nil {
+			errs.Add(dep.ImportPath, "", PhaseList, errors.New("not listed by go list"))
+			continue
+		}
+		if pkg.Error.Err != "" {
+			errs.Add(dep.ImportPath, pkg.Dir, PhaseList, errors.New(pkg.Error.Err))
+			continue
+		}
+		srcRoot := filepath.Join(pkg.Root, "src")
+		v, reporoot, err := vcs.FromDir(pkg.Dir, srcRoot)
+		if err != nil {
+			errs.Add(dep.ImportPath, pkg.Dir, PhaseVCS, err)
+			continue
+		}
+		dep.Dir = pkg.Dir
+		dep.vcs = v
+		if err := dep.VerifySource(); err != nil {
+			errs.Add(dep.ImportPath, dep.Dir, PhaseSource, err)
+			continue
+		}
+		dir := filepath.Join(srcRoot, reporoot)
+		if _, err := v.Resolve(dir, dep.Rev); err != nil && !errors.Is(err, vcs.ErrUnsupported) {
+			errs.Add(dep.ImportPath, dir, PhaseSource, fmt.Errorf("recorded revision %s not found", dep.Rev))
+		}
+	}
+	return errs.Err()
+}
+
+// CheckClean returns a PackageError for each repo of deps, as
+// returned by ListDeps or LoadVCSAndUpdate, whose checkout in GOPATH
+// has uncommitted changes, untracked files or commits on no remote,
+// so that the revision recorded couldn't be reproduced elsewhere.
+// Its cause is a *DirtyError. Dependencies not loaded from GOPATH
+// are skipped.
+func CheckClean(deps []Dependency) error {
+	var errs Errors
+	seen := make(map[string]bool) // repo dirs
+	for _, dep := range deps {
+		if dep.vcs == nil {
+			continue
+		}
+		dir := filepath.Join(dep.Workspace, "src", filepath.FromSlash(dep.Root))
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		st, err := dep.vcs.Status(dir, dep.Rev)
+		if err != nil {
+			errs.Add(dep.ImportPath, dir, PhaseVCS, err)
+			continue
+		}
+		if !st.Clean() {
+			errs.Add(dep.ImportPath, dir, PhaseVCS, &DirtyError{st})
+		}
+	}
+	return errs.Err()
+}
+
+// checkUnmodified returns a *DirtyError if the working tree of the
+// repo in dir, at revision rev, has changes that checking out
+// another revision would carry over or lose.
+func checkUnmodified(v *vcs.VCS, dir, rev string) error {
+	st, err := v.Status(dir, rev)
+	if err != nil {
+		return err
+	}
+	if len(st.Modified) > 0 {
+		return &DirtyError{&vcs.Status{Modified: st.Modified}}
+	}
+	return nil
+}
+
+// FillRoots sets the Root of each of deps that doesn't have one,
+// from its checkout in GOPATH if there is one, and otherwise by
+// resolving its import path, which may use the network.
+func FillRoots(deps []Dependency) error {
+	var paths []string
+	for _, dep := range deps {
+		if dep.Root == "" {
+			paths = append(paths, dep.ImportPath)
+		}
+	}
+	ps, err := loadPacks(paths...)
+	if err != nil {
+		return err
+	}
+	roots := make(map[string]string) // import path → repo root
+	for _, p := range ps {
+		if p.Error.Err != "" || p.Dir == "" {
+			continue
+		}
+		if _, reporoot, err := vcs.FromDir(p.Dir, filepath.Join(p.Root, "src")); err == nil {
+			roots[p.ImportPath] = filepath.ToSlash(reporoot)
+		}
+	}
+	for i := range deps {
+		dep := &deps[i]
+		if dep.Root != "" {
+			continue
+		}
+		if root, ok := roots[dep.ImportPath]; ok {
+			dep.Root = root
+			continue
+		}
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return err
+		}
+		dep.Root = rr.Root
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package pkgs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/azylman/govend/vcs"
+)
+
+// Phases of loading and vendoring a package, for PackageError.
+const (
+	PhaseList    = "list"    // Loading the package with go list.
+	PhaseFetch   = "fetch"   // Cloning its repo into GOPATH.
+	PhaseVCS     = "vcs"     // Finding its repo and the revision checked out.
+	PhaseSource  = "source"  // Checking the checkout against the recorded source.
+	PhaseCopy    = "copy"    // Copying its files into a vendor directory.
+	PhaseRewrite = "rewrite" // Rewriting the imports of its files.
+)
+
+// ErrDirty matches the cause of a PackageError for a checkout with
+// changes that aren't committed or pushed, a *DirtyError.
+var ErrDirty = errors.New("dirty working tree")
+
+// A DirtyError says what makes a checkout dirty.
+type DirtyError struct {
+	Status *vcs.Status
+}
+
+func (e *DirtyError) Error() string {
+	return ErrDirty.Error() + ": " + e.Status.String()
+}
+
+// Is reports whether target is ErrDirty.
+func (e *DirtyError) Is(target error) bool { return target == ErrDirty }
+
+// A PackageError is a problem with one package.
+type PackageError struct {
+	ImportPath string
+	Dir        string // Directory of the package, if known.
+	Phase      string // One of the Phase constants.
+	Err        error
+}
+
+func (e *PackageError) Error() string {
+	s := e.ImportPath
+	if e.Dir != "" {
+		s += " (" + e.Dir + ")"
+	}
+	return s + ": " + e.Phase + ": " + e.Err.Error()
+}
+
+func (e *PackageError) Unwrap() error { return e.Err }
+
+// Errors holds the PackageErrors of an operation that carries on
+// past a broken package, so that they can be reported together.
+// Use errors.As to find a PackageError in it.
+type Errors []*PackageError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := []string{fmt.Sprintf("%d packages failed:", len(e))}
+	for _, err := range e {
+		msgs = append(msgs, "\t"+err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Add records err for the package with import path importPath in
+// directory dir. An err that is already a *PackageError is recorded
+// as is.
+func (e *Errors) Add(importPath, dir, phase string, err error) {
+	var perr *PackageError
+	if !errors.As(err, &perr) {
+		perr = &PackageError{ImportPath: importPath, Dir: dir, Phase: phase, Err: err}
+	}
+	*e = append(*e, perr)
+}
+
+// Err returns e, or nil if it is empty.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,56 @@
+package pkgs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/azylman/govend/vcs"
+)
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	if errs.Err() != nil {
+		t.Fatalf("empty Errors.Err() = %v, want nil", errs.Err())
+	}
+	errs.Add("D", "/go/src/D", PhaseVCS, ErrDirty)
+	errs.Add("E", "", PhaseList, errors.New("cannot find package"))
+	errs.Add("F", "/go/src/F", PhaseList, &PackageError{"F", "/go/src/F", PhaseCopy, os.ErrPermission})
+
+	want := "3 packages failed:\n" +
+		"\tD (/go/src/D): vcs: dirty working tree\n" +
+		"\tE: list: cannot find package\n" +
+		"\tF (/go/src/F): copy: permission denied"
+	if g := errs.Error(); g != want {
+		t.Errorf("Error() = %q, want %q", g, want)
+	}
+	if g := errs[:1].Error(); g != "D (/go/src/D): vcs: dirty working tree" {
+		t.Errorf("single Error() = %q", g)
+	}
+
+	err := errs.Err()
+	var perr *PackageError
+	if !errors.As(err, &perr) || perr.ImportPath != "D" {
+		t.Errorf("errors.As found %v, want D", perr)
+	}
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("errors.Is(err, ErrDirty) = false")
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("errors.Is(err, os.ErrPermission) = false")
+	}
+}
+
+func TestDirtyError(t *testing.T) {
+	err := error(&PackageError{"D", "/go/src/D", PhaseVCS, &DirtyError{&vcs.Status{
+		Modified:  []string{"main.go"},
+		Untracked: []string{"extra.go", "x/y.go"},
+	}}})
+	want := "D (/go/src/D): vcs: dirty working tree: modified main.go; untracked extra.go, x/y.go"
+	if g := err.Error(); g != want {
+		t.Errorf("Error() = %q, want %q", g, want)
+	}
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("errors.Is(err, ErrDirty) = false")
+	}
+}
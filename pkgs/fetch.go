@@ -0,0 +1,80 @@
+package pkgs
+
+import (
+	"go/build"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/azylman/govend/vcs"
+)
+
+// FetchMissing clones the repo of each of deps that go list can't
+// find into the first GOPATH workspace. Repos are fetched from
+// dep.Source, if set. If atRev is set, the recorded revision of
+// each is checked out, so that saving again reproduces the
+// manifest; otherwise the tip of its default branch is left
+// checked out, so that it can be updated.
+func FetchMissing(deps []Dependency, atRev bool) error {
+	missing, err := missingDeps(deps)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	workspaces := filepath.SplitList(build.Default.GOPATH)
+	if len(workspaces) == 0 {
+		return nil
+	}
+	var errs Errors
+	done := make(map[string]bool) // repo roots
+	for _, dep := range missing {
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			errs.Add(dep.ImportPath, "", PhaseFetch, err)
+			continue
+		}
+		if done[rr.Root] {
+			continue
+		}
+		done[rr.Root] = true
+		dir := filepath.Join(workspaces[0], "src", filepath.FromSlash(rr.Root))
+		if _, err := os.Stat(dir); err == nil {
+			continue // Only some packages are missing; go list will say why.
+		}
+		log.Printf("fetching %s from %s", rr.Root, rr.Repo)
+		if atRev && dep.Rev != "" {
+			err = rr.VCS.Create(dir, rr.Repo, dep.Rev)
+		} else {
+			err = rr.VCS.Clone(dir, rr.Repo)
+		}
+		if err != nil {
+			errs.Add(dep.ImportPath, dir, PhaseFetch, err)
+		}
+	}
+	return errs.Err()
+}
+
+// missingDeps returns the dependencies in deps
+// that aren't in any GOPATH workspace.
+func missingDeps(deps []Dependency) ([]Dependency, error) {
+	var paths []string
+	for _, dep := range deps {
+		paths = append(paths, dep.ImportPath)
+	}
+	ps, err := loadPacks(paths...)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, p := range ps {
+		if p.Dir != "" {
+			found[p.ImportPath] = true
+		}
+	}
+	var missing []Dependency
+	for _, dep := range deps {
+		if !found[dep.ImportPath] {
+			missing = append(missing, dep)
+		}
+	}
+	return missing, nil
+}
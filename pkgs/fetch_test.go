@@ -0,0 +1,136 @@
+package pkgs
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingDeps(t *testing.T) {
+	gopath, err := ioutil.TempDir("", "govend-gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+	dir := filepath.Join(gopath, "src", "example.com", "here")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "here.go"), []byte("package here\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath)
+
+	missing, err := missingDeps([]Dependency{
+		{ImportPath: "example.com/here"},
+		{ImportPath: "example.com/gone"},
+		{ImportPath: "example.com/gone/sub"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, dep := range missing {
+		got = append(got, dep.ImportPath)
+	}
+	if len(got) != 2 || got[0] != "example.com/gone" || got[1] != "example.com/gone/sub" {
+		t.Errorf("missingDeps = %v, want [example.com/gone example.com/gone/sub]", got)
+	}
+}
+
+func TestFetchMissing(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	upstream := filepath.Join(tmp, "upstream")
+	if err := os.MkdirAll(upstream, 0777); err != nil {
+		t.Fatal(err)
+	}
+	git(t, upstream, "init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(upstream, "y.go"), []byte("package y\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(t, upstream, "add", ".")
+	git(t, upstream, "-c", "user.name=govend", "-c", "user.email=govend@example.com", "commit", "-q", "-m", "y")
+	head := git(t, upstream, "rev-parse", "HEAD")
+
+	gopath := filepath.Join(tmp, "gopath")
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath)
+	defer func(old string) { build.Default.GOPATH = old }(build.Default.GOPATH)
+	build.Default.GOPATH = gopath
+
+	deps := []Dependency{{ImportPath: "github.com/x/y", Source: "file://" + upstream}}
+	if err := FetchMissing(deps, false); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := LoadVCSAndUpdate(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 1 || updated[0].Rev != head {
+		t.Fatalf("LoadVCSAndUpdate = %+v, want github.com/x/y at %s", updated, head)
+	}
+	want := filepath.Join(gopath, "src", "github.com", "x", "y")
+	if updated[0].Dir != want {
+		t.Errorf("Dir = %s, want %s", updated[0].Dir, want)
+	}
+}
+
+func TestFetchMissingAtRev(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	upstream := filepath.Join(tmp, "upstream")
+	if err := os.MkdirAll(upstream, 0777); err != nil {
+		t.Fatal(err)
+	}
+	git(t, upstream, "init", "-q")
+	var revs []string
+	for _, body := range []string{"package y\n", "package y\n\nvar V int\n"} {
+		if err := ioutil.WriteFile(filepath.Join(upstream, "y.go"), []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+		git(t, upstream, "add", ".")
+		git(t, upstream, "-c", "user.name=govend", "-c", "user.email=govend@example.com", "commit", "-q", "-m", "y")
+		revs = append(revs, git(t, upstream, "rev-parse", "HEAD"))
+	}
+
+	gopath := filepath.Join(tmp, "gopath")
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", gopath)
+	defer func(old string) { build.Default.GOPATH = old }(build.Default.GOPATH)
+	build.Default.GOPATH = gopath
+
+	deps := []Dependency{{ImportPath: "github.com/x/y", Source: "file://" + upstream, Rev: revs[0]}}
+	if err := FetchMissing(deps, true); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := LoadVCSAndUpdate(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 1 || updated[0].Rev != revs[0] {
+		t.Fatalf("LoadVCSAndUpdate = %+v, want github.com/x/y at %s", updated, revs[0])
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,74 @@
+package pkgs
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// A Package is a node in the import graph returned by LoadGraph.
+type Package struct {
+	ImportPath string   // Unqualified, even if the package is vendored.
+	Dir        string   // Directory holding the package's files.
+	GoFiles    []string // Non-test .go files, relative to Dir.
+	Imports    []string // Unqualified import paths of direct imports.
+	Standard   bool
+}
+
+// LoadGraph loads the named packages and everything they depend on,
+// excluding tests. The result is keyed by unqualified import path, so
+// a package vendored as "C/vendor/D" appears under "D".
+func LoadGraph(name ...string) (map[string]*Package, error) {
+	ps, err := loadPacks(name...)
+	if err != nil {
+		return nil, err
+	}
+	var errs Errors
+	var paths []string
+	for _, p := range ps {
+		if p.Error.Err != "" {
+			errs.Add(p.ImportPath, p.Dir, PhaseList, errors.New(p.Error.Err))
+			continue
+		}
+		paths = append(paths, p.Deps...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	sort.Strings(paths)
+	deps, err := loadPacks(uniq(paths)...)
+	if err != nil {
+		return nil, err
+	}
+	graph := make(map[string]*Package)
+	for _, p := range append(ps, deps...) {
+		if p.Error.Err != "" {
+			errs.Add(p.ImportPath, p.Dir, PhaseList, errors.New(p.Error.Err))
+			continue
+		}
+		pkg := &Package{
+			ImportPath: Unqualify(p.ImportPath),
+			Dir:        p.Dir,
+			Standard:   p.Standard,
+		}
+		pkg.GoFiles = append(pkg.GoFiles, p.GoFiles...)
+		pkg.GoFiles = append(pkg.GoFiles, p.CgoFiles...)
+		for _, imp := range p.Imports {
+			pkg.Imports = append(pkg.Imports, Unqualify(imp))
+		}
+		graph[pkg.ImportPath] = pkg
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return graph, nil
+}
+
+// Files returns the full paths of p's non-test .go files.
+func (p *Package) Files() []string {
+	var files []string
+	for _, f := range p.GoFiles {
+		files = append(files, filepath.Join(p.Dir, f))
+	}
+	return files
+}
@@ -0,0 +1,142 @@
+package pkgs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matchPattern returns a function that reports whether
+// a name matches pattern, using the same rules as the go tool:
+// "..." matches any string, and a trailing "/..." also
+// matches the empty string, so "net/..." matches "net".
+func matchPattern(pattern string) func(name string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	// Special case: foo/... matches foo too.
+	if strings.HasSuffix(re, `/.*`) {
+		re = re[:len(re)-len(`/.*`)] + `(/.*)?`
+	}
+	reg := regexp.MustCompile(`^` + re + `$`)
+	return reg.MatchString
+}
+
+// Match reports whether importPath matches pattern.
+func Match(pattern, importPath string) bool {
+	return matchPattern(pattern)(importPath)
+}
+
+// A Pattern selects packages by import path, e.g. in the arguments
+// of govend -u and in ignore lists. It is written
+//
+//	[-]path[@rev]
+//
+// where path may use "..." as for the go tool, a leading "-" makes
+// the pattern exclude what it matches, and a trailing "@rev" gives
+// the revision to move the matching dependencies to.
+type Pattern struct {
+	Path   string
+	Negate bool
+	Rev    string
+}
+
+// ParsePattern parses s as a Pattern.
+func ParsePattern(s string) (Pattern, error) {
+	var p Pattern
+	rest := s
+	if strings.HasPrefix(rest, "-") {
+		p.Negate = true
+		rest = rest[1:]
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		p.Rev = rest[i+1:]
+		rest = rest[:i]
+		if p.Rev == "" {
+			return Pattern{}, fmt.Errorf("pattern %q: empty revision", s)
+		}
+		if p.Negate {
+			return Pattern{}, fmt.Errorf("pattern %q: excluded packages can't have a revision", s)
+		}
+	}
+	if rest == "" {
+		return Pattern{}, fmt.Errorf("pattern %q: empty import path", s)
+	}
+	p.Path = rest
+	return p, nil
+}
+
+func (p Pattern) String() string {
+	s := p.Path
+	if p.Negate {
+		s = "-" + s
+	}
+	if p.Rev != "" {
+		s += "@" + p.Rev
+	}
+	return s
+}
+
+// Match reports whether importPath matches p's path,
+// regardless of Negate.
+func (p Pattern) Match(importPath string) bool {
+	return matchPattern(p.Path)(importPath)
+}
+
+// MatchDep reports whether the import path of dep or, if it is
+// known, its repo root matches p's path, regardless of Negate.
+// So "github.com/x/y" matches every package in that repo.
+func (p Pattern) MatchDep(dep Dependency) bool {
+	return p.Match(dep.ImportPath) || dep.Root != "" && p.Match(dep.Root)
+}
+
+// Patterns is a list of patterns. Something matches the list if it
+// matches one of the patterns that aren't negated, and none of those
+// that are, wherever they appear in the list.
+type Patterns []Pattern
+
+// ParsePatterns parses each of args as a Pattern.
+func ParsePatterns(args []string) (Patterns, error) {
+	var ps Patterns
+	for _, arg := range args {
+		p, err := ParsePattern(arg)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// Match reports whether importPath matches ps.
+func (ps Patterns) Match(importPath string) bool {
+	return ps.match(func(p Pattern) bool { return p.Match(importPath) })
+}
+
+// MatchDep reports whether dep matches ps, using Pattern.MatchDep.
+func (ps Patterns) MatchDep(dep Dependency) bool {
+	return ps.match(func(p Pattern) bool { return p.MatchDep(dep) })
+}
+
+func (ps Patterns) match(f func(Pattern) bool) bool {
+	ok := false
+	for _, p := range ps {
+		if f(p) {
+			if p.Negate {
+				return false
+			}
+			ok = true
+		}
+	}
+	return ok
+}
+
+// Rev returns the revision given by the first pattern in ps that
+// matches dep and has one, or "" if there is none.
+func (ps Patterns) Rev(dep Dependency) string {
+	for _, p := range ps {
+		if !p.Negate && p.Rev != "" && p.MatchDep(dep) {
+			return p.Rev
+		}
+	}
+	return ""
+}
@@ -30,3 +30,66 @@ func TestMatchPattern(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePattern(t *testing.T) {
+	cases := []struct {
+		s    string
+		want Pattern
+		err  bool
+	}{
+		{s: "net/...", want: Pattern{Path: "net/..."}},
+		{s: "-net/http", want: Pattern{Path: "net/http", Negate: true}},
+		{s: "github.com/x/y@v1.2.0", want: Pattern{Path: "github.com/x/y", Rev: "v1.2.0"}},
+		{s: "user@host/x@abc", want: Pattern{Path: "user@host/x", Rev: "abc"}},
+		{s: "net@", err: true},
+		{s: "@v1", err: true},
+		{s: "-", err: true},
+		{s: "-net@v1", err: true},
+	}
+	for _, test := range cases {
+		p, err := ParsePattern(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePattern(%q) = %+v, want error", test.s, p)
+			}
+			continue
+		}
+		if err != nil || p != test.want {
+			t.Errorf("ParsePattern(%q) = %+v, %v want %+v", test.s, p, err, test.want)
+		}
+		if p.String() != test.s {
+			t.Errorf("ParsePattern(%q).String() = %q", test.s, p.String())
+		}
+	}
+}
+
+func TestPatternsMatchDep(t *testing.T) {
+	cases := []struct {
+		pats []string
+		dep  Dependency
+		want bool
+		rev  string
+	}{
+		{[]string{"github.com/x/..."}, Dependency{ImportPath: "github.com/x/y/z"}, true, ""},
+		{[]string{"github.com/x/y"}, Dependency{ImportPath: "github.com/x/y/z"}, false, ""},
+		{[]string{"github.com/x/y"}, Dependency{ImportPath: "github.com/x/y/z", Root: "github.com/x/y"}, true, ""},
+		{[]string{"github.com/x/y@v2"}, Dependency{ImportPath: "github.com/x/y/z", Root: "github.com/x/y"}, true, "v2"},
+		{[]string{"...", "-github.com/x/y"}, Dependency{ImportPath: "github.com/x/yz"}, true, ""},
+		{[]string{"...", "-github.com/x/y"}, Dependency{ImportPath: "github.com/x/y/z", Root: "github.com/x/y"}, false, ""},
+		{[]string{"-github.com/x/...", "..."}, Dependency{ImportPath: "github.com/x/y"}, false, ""},
+		{[]string{"-github.com/x/..."}, Dependency{ImportPath: "github.com/w/y"}, false, ""},
+		{[]string{"github.com/w/...@v1", "...@v2"}, Dependency{ImportPath: "github.com/x/y"}, true, "v2"},
+	}
+	for _, test := range cases {
+		ps, err := ParsePatterns(test.pats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ps.MatchDep(test.dep); got != test.want {
+			t.Errorf("%v.MatchDep(%+v) = %v want %v", ps, test.dep, got, test.want)
+		}
+		if got := ps.Rev(test.dep); got != test.rev {
+			t.Errorf("%v.Rev(%+v) = %q want %q", ps, test.dep, got, test.rev)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package pkgs
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -11,6 +12,7 @@ type pack struct {
 	Dir        string
 	Root       string
 	ImportPath string
+	Imports    []string
 	Deps       []string
 	Standard   bool
 
@@ -40,15 +42,41 @@ func ImportPath(name string) (string, error) {
 	return res.ImportPath, nil
 }
 
+// Workspace returns the GOPATH workspace holding package name.
+func Workspace(name string) (string, error) {
+	out, err := exec.Command("go", "list", "-e", "-json", name).Output()
+	if err != nil {
+		return "", err
+	}
+	var res struct{ Root string }
+	if err := json.Unmarshal(out, &res); err != nil {
+		return "", err
+	}
+	if res.Root == "" {
+		return "", fmt.Errorf("%s is not in a GOPATH workspace", name)
+	}
+	return res.Root, nil
+}
+
 // loadPacks loads the named packages using go list -json.
 // Unlike the go tool, an empty argument list is treated as
 // an empty list; "." must be given explicitly if desired.
 func loadPacks(name ...string) (a []*pack, err error) {
+	return loadPacksIn("", name...)
+}
+
+// loadPacksIn is like loadPacks, but looks for packages in the
+// workspaces listed in gopath, rather than $GOPATH, if it isn't
+// empty.
+func loadPacksIn(gopath string, name ...string) (a []*pack, err error) {
 	if len(name) == 0 {
 		return nil, nil
 	}
 	args := []string{"list", "-e", "-json"}
 	cmd := exec.Command("go", append(args, name...)...)
+	if gopath != "" {
+		cmd.Env = append(os.Environ(), "GOPATH="+gopath)
+	}
 	r, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/vend"
+)
+
+var cmdRestore = &Command{
+	Name:  "restore",
+	Short: "copy the recorded revision of each dependency into vendor/",
+	Run:   runRestore,
+}
+
+var (
+	restoreCacheDir string
+	restoreProfile  string
+	restoreOpts     vend.RestoreOptions
+)
+
+func init() {
+	cmdRestore.Flag.StringVar(&restoreOpts.Bundle, "bundle", "", "restore from the vendor bundle at `path` instead of the cache")
+	cmdRestore.Flag.StringVar(&restoreCacheDir, "cache-dir", cache.DefaultDir(), "`directory` of the private cache")
+	cmdRestore.Flag.Var(&restoreOpts.ImportComments, "import-comments", "what to do with import comments of vendored files: strip, keep or rewrite")
+	cmdRestore.Flag.StringVar(&restoreProfile, "profile", "", "restore the vendor directory of the `profile` named in Govend.toml")
+	cmdRestore.Flag.BoolVar(&restoreOpts.Rewrite, "r", false, "rewrite imports of vendored packages to their fully-qualified vendor/ path")
+}
+
+func runRestore(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	if restoreProfile != "" {
+		p, err := lookupProfile(restoreProfile)
+		if err != nil {
+			return err
+		}
+		restoreOpts.Vendor = p.Vendor
+	}
+	restoreOpts.Cache = &cache.Cache{Dir: restoreCacheDir}
+	restored, err := vend.Restore(restoreOpts)
+	if err != nil {
+		return err
+	}
+	warnUnparsed(restored.Unparsed)
+	return nil
+}
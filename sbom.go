@@ -0,0 +1,423 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/vend"
+)
+
+var cmdSBOM = &Command{
+	Name:  "sbom",
+	Short: "write a software bill of materials for the vendored dependencies",
+	Run:   runSBOM,
+}
+
+var (
+	sbomFormat string
+	sbomOutput string
+)
+
+func init() {
+	cmdSBOM.Flag.StringVar(&sbomFormat, "format", "spdx", "document `format`: spdx or cyclonedx")
+	cmdSBOM.Flag.StringVar(&sbomOutput, "o", "", "write the document to `file` instead of standard output")
+}
+
+// An sbomComponent is one vendored repo.
+type sbomComponent struct {
+	Root        string
+	ImportPaths []string
+	Rev         string
+	Version     string // Semver tag Rev was chosen from, if any.
+	Files       []sbomFile
+	Licenses    []string // SPDX identifiers of detected licenses.
+	SHA256      string   // Hash of the hashes and names of Files.
+}
+
+// An sbomFile is a vendored file, named relative to vendor/.
+type sbomFile struct {
+	Name   string
+	SHA1   string
+	SHA256 string
+}
+
+func runSBOM(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	manifest, err := vend.CurrentManifest(vend.VendorDir)
+	if err != nil {
+		return err
+	}
+	if err := pkgs.FillRoots(manifest.Deps); err != nil {
+		return err
+	}
+	comps, err := sbomComponents(vend.VendorDir, manifest.Deps)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	switch sbomFormat {
+	case "spdx":
+		doc = spdxDocument(manifest.ImportPath, comps, time.Now().UTC())
+	case "cyclonedx":
+		doc = cycloneDXDocument(manifest.ImportPath, comps, time.Now().UTC())
+	default:
+		return fmt.Errorf("unknown format %q", sbomFormat)
+	}
+	w := io.Writer(os.Stdout)
+	if sbomOutput != "" {
+		f, err := os.Create(sbomOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return writeJSON(w, doc)
+}
+
+// sbomComponents groups deps by repo root, and hashes their files
+// in the vendor directory and detects their licenses. Each of deps
+// must have its Root set.
+func sbomComponents(vendor string, deps []pkgs.Dependency) ([]sbomComponent, error) {
+	var comps []sbomComponent
+	byRoot := make(map[string]int) // index in comps
+	for _, dep := range deps {
+		i, ok := byRoot[dep.Root]
+		if !ok {
+			i = len(comps)
+			byRoot[dep.Root] = i
+			comps = append(comps, sbomComponent{Root: dep.Root, Rev: dep.Rev, Version: dep.Tag})
+		}
+		comps[i].ImportPaths = append(comps[i].ImportPaths, dep.ImportPath)
+	}
+	for i := range comps {
+		c := &comps[i]
+		seen := make(map[string]bool)
+		for _, p := range c.ImportPaths {
+			files, err := hashFiles(vendor, p, seen)
+			if err != nil {
+				return nil, err
+			}
+			c.Files = append(c.Files, files...)
+		}
+		sort.Sort(sbomFiles(c.Files))
+		h := sha256.New()
+		for _, f := range c.Files {
+			fmt.Fprintf(h, "%s  %s\n", f.SHA256, f.Name)
+		}
+		c.SHA256 = hex.EncodeToString(h.Sum(nil))
+		licenses, err := detectLicenses(vendor, c.Root, c.ImportPaths)
+		if err != nil {
+			return nil, err
+		}
+		c.Licenses = licenses
+	}
+	return comps, nil
+}
+
+type sbomFiles []sbomFile
+
+func (f sbomFiles) Len() int           { return len(f) }
+func (f sbomFiles) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f sbomFiles) Less(i, j int) bool { return f[i].Name < f[j].Name }
+
+// hashFiles hashes the regular files in the directory of
+// importPath in vendor, skipping those already in seen.
+func hashFiles(vendor, importPath string, seen map[string]bool) ([]sbomFile, error) {
+	var files []sbomFile
+	root := filepath.Join(vendor, filepath.FromSlash(importPath))
+	err := filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(vendor, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if seen[rel] {
+			return nil
+		}
+		seen[rel] = true
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		s1, s256 := sha1.Sum(b), sha256.Sum256(b)
+		files = append(files, sbomFile{
+			Name:   rel,
+			SHA1:   hex.EncodeToString(s1[:]),
+			SHA256: hex.EncodeToString(s256[:]),
+		})
+		return nil
+	})
+	return files, err
+}
+
+var licenseFileRE = regexp.MustCompile(`(?i)^(licen[cs]e|copying|unlicense)([.-].*)?$`)
+
+// licensePatterns identifies licenses by a phrase in their text.
+// More specific licenses come before those they'd be mistaken for.
+var licensePatterns = []struct {
+	id string
+	re *regexp.Regexp
+}{
+	{"Apache-2.0", regexp.MustCompile(`(?i)apache license,?\s+version 2\.0`)},
+	{"MPL-2.0", regexp.MustCompile(`(?i)mozilla public license,?\s+version 2\.0`)},
+	{"AGPL-3.0", regexp.MustCompile(`(?i)gnu affero general public license\s+version 3`)},
+	{"LGPL-3.0", regexp.MustCompile(`(?i)gnu lesser general public license\s+version 3`)},
+	{"LGPL-2.1", regexp.MustCompile(`(?i)gnu lesser general public license\s+version 2\.1`)},
+	{"GPL-3.0", regexp.MustCompile(`(?i)gnu general public license\s+version 3`)},
+	{"GPL-2.0", regexp.MustCompile(`(?i)gnu general public license\s+version 2`)},
+	{"BSD-3-Clause", regexp.MustCompile(`(?i)neither the name of .* nor the names of its\s+contributors`)},
+	{"BSD-2-Clause", regexp.MustCompile(`(?i)redistributions in binary form must reproduce`)},
+	{"MIT", regexp.MustCompile(`(?i)permission is hereby granted, free of charge`)},
+	{"ISC", regexp.MustCompile(`(?i)permission to use, copy, modify, and(/or)? distribute this software for any`)},
+	{"Unlicense", regexp.MustCompile(`(?i)this is free and unencumbered software released into the public domain`)},
+	{"CC0-1.0", regexp.MustCompile(`(?i)creative commons (legal code\s+)?cc0 1\.0`)},
+}
+
+// detectLicenses returns the SPDX identifiers of the licenses in
+// license files in the vendored directories of importPaths and
+// their parents up to root. A license file that can't be identified
+// is reported as "NOASSERTION".
+func detectLicenses(vendor, root string, importPaths []string) ([]string, error) {
+	dirs := make(map[string]bool)
+	for _, p := range importPaths {
+		for ; p != "." && p != "/"; p = path.Dir(p) {
+			dirs[p] = true
+			if p == root {
+				break
+			}
+		}
+	}
+	found := make(map[string]bool)
+	for dir := range dirs {
+		infos, err := ioutil.ReadDir(filepath.Join(vendor, filepath.FromSlash(dir)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range infos {
+			if !fi.Mode().IsRegular() || !licenseFileRE.MatchString(fi.Name()) {
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(vendor, filepath.FromSlash(dir), fi.Name()))
+			if err != nil {
+				return nil, err
+			}
+			found[identifyLicense(b)] = true
+		}
+	}
+	var ids []string
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func identifyLicense(text []byte) string {
+	for _, l := range licensePatterns {
+		if l.re.Match(text) {
+			return l.id
+		}
+	}
+	return "NOASSERTION"
+}
+
+// purl returns the package URL of c.
+func (c sbomComponent) purl() string {
+	s := "pkg:golang/" + c.Root
+	if c.Version != "" {
+		return s + "@" + c.Version
+	}
+	return s + "@" + c.Rev
+}
+
+// licenseExpr returns c's licenses as an SPDX license expression.
+func (c sbomComponent) licenseExpr() string {
+	var ids []string
+	for _, id := range c.Licenses {
+		if id != "NOASSERTION" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return "NOASSERTION"
+	}
+	return strings.Join(ids, " AND ")
+}
+
+var spdxIDRE = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// spdxIDs hands out SPDX identifiers unique within a document.
+type spdxIDs map[string]bool
+
+// id returns an identifier for the element of kind named name. As
+// characters SPDX doesn't allow are replaced, names such as a_b.go
+// and a-b.go could clash, so later ones get a counter suffix.
+func (ids spdxIDs) id(kind, name string) string {
+	base := "SPDXRef-" + kind + "-" + spdxIDRE.ReplaceAllString(name, "-")
+	id := base
+	for n := 2; ids[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids[id] = true
+	return id
+}
+
+// spdxDocument returns an SPDX 2.3 document describing comps.
+func spdxDocument(name string, comps []sbomComponent, now time.Time) map[string]interface{} {
+	var packages, files, rels []map[string]interface{}
+	ids := make(spdxIDs)
+	for _, c := range comps {
+		id := ids.id("Package", c.Root)
+		h := sha1.New()
+		var fileIDs []string
+		var hashes []string
+		for _, f := range c.Files {
+			hashes = append(hashes, f.SHA1)
+			fid := ids.id("File", f.Name)
+			fileIDs = append(fileIDs, fid)
+			files = append(files, map[string]interface{}{
+				"fileName": "./" + vend.VendorDir + "/" + f.Name,
+				"SPDXID":   fid,
+				"checksums": []map[string]string{
+					{"algorithm": "SHA1", "checksumValue": f.SHA1},
+					{"algorithm": "SHA256", "checksumValue": f.SHA256},
+				},
+				"licenseConcluded": "NOASSERTION",
+				"copyrightText":    "NOASSERTION",
+			})
+		}
+		// The package verification code is the SHA1 of
+		// the sorted SHA1s of its files.
+		sort.Strings(hashes)
+		io.WriteString(h, strings.Join(hashes, ""))
+		version := c.Version
+		if version == "" {
+			version = c.Rev
+		}
+		packages = append(packages, map[string]interface{}{
+			"name":             c.Root,
+			"SPDXID":           id,
+			"versionInfo":      version,
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    true,
+			"packageVerificationCode": map[string]string{
+				"packageVerificationCodeValue": hex.EncodeToString(h.Sum(nil)),
+			},
+			"checksums": []map[string]string{
+				{"algorithm": "SHA256", "checksumValue": c.SHA256},
+			},
+			"licenseConcluded":     c.licenseExpr(),
+			"licenseDeclared":      c.licenseExpr(),
+			"licenseInfoFromFiles": nonEmpty(c.Licenses, "NOASSERTION"),
+			"copyrightText":        "NOASSERTION",
+			"sourceInfo":           fmt.Sprintf("revision %s; packages %s", c.Rev, strings.Join(c.ImportPaths, ", ")),
+			"externalRefs": []map[string]string{
+				{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": c.purl()},
+			},
+			"hasFiles": fileIDs,
+		})
+		rels = append(rels, map[string]interface{}{
+			"spdxElementId":      "SPDXRef-DOCUMENT",
+			"relationshipType":   "DESCRIBES",
+			"relatedSpdxElement": id,
+		})
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              name,
+		"documentNamespace": "https://spdx.org/spdxdocs/govend/" + name + "-" + uuid(),
+		"creationInfo": map[string]interface{}{
+			"created":  now.Format(time.RFC3339),
+			"creators": []string{"Tool: govend"},
+		},
+		"packages":      packages,
+		"files":         files,
+		"relationships": rels,
+	}
+}
+
+// cycloneDXDocument returns a CycloneDX 1.5 document describing comps.
+func cycloneDXDocument(name string, comps []sbomComponent, now time.Time) map[string]interface{} {
+	var components []map[string]interface{}
+	for _, c := range comps {
+		var licenses []map[string]interface{}
+		for _, id := range c.Licenses {
+			if id != "NOASSERTION" {
+				licenses = append(licenses, map[string]interface{}{"license": map[string]string{"id": id}})
+			}
+		}
+		props := []map[string]string{{"name": "govend:rev", "value": c.Rev}}
+		for _, p := range c.ImportPaths {
+			props = append(props, map[string]string{"name": "govend:importPath", "value": p})
+		}
+		comp := map[string]interface{}{
+			"type":       "library",
+			"bom-ref":    c.purl(),
+			"name":       c.Root,
+			"purl":       c.purl(),
+			"hashes":     []map[string]string{{"alg": "SHA-256", "content": c.SHA256}},
+			"properties": props,
+		}
+		if c.Version != "" {
+			comp["version"] = c.Version
+		}
+		if len(licenses) > 0 {
+			comp["licenses"] = licenses
+		}
+		components = append(components, comp)
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + uuid(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": now.Format(time.RFC3339),
+			"tools":     []map[string]string{{"name": "govend"}},
+			"component": map[string]string{"type": "application", "name": name},
+		},
+		"components": components,
+	}
+}
+
+func nonEmpty(a []string, def string) []string {
+	if len(a) == 0 {
+		return []string{def}
+	}
+	return a
+}
+
+// uuid returns a random (version 4) UUID.
+func uuid() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSBOMComponents(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(vendor)
+
+	mit := "Permission is hereby granted, free of charge, to any person obtaining a copy\n"
+	for name, body := range map[string]string{
+		"D/LICENSE":    mit,
+		"D/main.go":    "package D\n",
+		"D/A/a.go":     "package A\n",
+		"E/F/f.go":     "package F\n",
+		"E/F/COPYING":  "some license we don't know",
+		"E/G/ignored":  "not vendored as a dependency",
+		"X/unrelated":  "",
+		"D/A/LICENSE2": mit,
+	} {
+		assert.Nil(t, writeFile(filepath.Join(vendor, filepath.FromSlash(name)), body))
+	}
+	deps := []pkgs.Dependency{
+		{ImportPath: "D", Root: "D", Rev: "d1", Tag: "v1.0.0"},
+		{ImportPath: "D/A", Root: "D", Rev: "d1", Tag: "v1.0.0"},
+		{ImportPath: "E/F", Root: "E", Rev: "e1", Comment: "v0.1.0-2-gabcdef0"},
+	}
+	comps, err := sbomComponents(vendor, deps)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(comps))
+
+	d := comps[0]
+	assert.Equal(t, "D", d.Root)
+	assert.Equal(t, []string{"D", "D/A"}, d.ImportPaths)
+	assert.Equal(t, "pkg:golang/D@v1.0.0", d.purl())
+	var names []string
+	for _, f := range d.Files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"D/A/LICENSE2", "D/A/a.go", "D/LICENSE", "D/main.go"}, names)
+	assert.Equal(t, []string{"MIT"}, d.Licenses)
+
+	e := comps[1]
+	// A description isn't a valid purl version; the revision is.
+	assert.Equal(t, "", e.Version)
+	assert.Equal(t, "pkg:golang/E@e1", e.purl())
+	assert.Equal(t, 2, len(e.Files))
+	assert.Equal(t, []string{"NOASSERTION"}, e.Licenses)
+	assert.Equal(t, "NOASSERTION", e.licenseExpr())
+
+	// The hash of a component depends only on its files.
+	again, err := sbomComponents(vendor, deps)
+	assert.Nil(t, err)
+	assert.Equal(t, d.SHA256, again[0].SHA256)
+	assert.NotEqual(t, d.SHA256, e.SHA256)
+}
+
+func TestSPDXIDs(t *testing.T) {
+	ids := make(spdxIDs)
+	assert.Equal(t, "SPDXRef-File-D-a-b.go", ids.id("File", "D/a-b.go"))
+	assert.Equal(t, "SPDXRef-File-D-a-b.go-2", ids.id("File", "D/a_b.go"))
+	assert.Equal(t, "SPDXRef-File-D-a-b.go-3", ids.id("File", "D/a b.go"))
+	assert.Equal(t, "SPDXRef-Package-D-a-b.go", ids.id("Package", "D/a_b.go"))
+}
+
+func TestCycloneDXVersion(t *testing.T) {
+	comps := []sbomComponent{{Root: "D", Rev: "d1", Version: "v1.0.0"}, {Root: "E", Rev: "e1"}}
+	doc := cycloneDXDocument("C", comps, time.Time{})
+	components := doc["components"].([]map[string]interface{})
+	assert.Equal(t, "v1.0.0", components[0]["version"])
+	_, ok := components[1]["version"]
+	assert.False(t, ok)
+}
+
+// writeFile is like ioutil.WriteFile but it creates
+// intermediate directories with os.MkdirAll.
+func writeFile(name, body string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, []byte(body), 0666)
+}
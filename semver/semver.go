@@ -0,0 +1,232 @@
+// Package semver parses semantic version tags and the version
+// constraints govend accepts for them, such as "^1.2" or "~0.3".
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Version is a parsed semantic version.
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // Pre-release suffix, without the leading "-".
+}
+
+// Parse parses a version such as "v1.2.3", "1.2" or "v2.0.0-rc1".
+// The leading "v" is optional, as are the minor and patch numbers.
+// Build metadata after a "+" is ignored.
+func Parse(s string) (Version, error) {
+	var v Version
+	t := strings.TrimPrefix(s, "v")
+	if i := strings.Index(t, "+"); i >= 0 {
+		t = t[:i]
+	}
+	if i := strings.Index(t, "-"); i >= 0 {
+		v.Pre = t[i+1:]
+		t = t[:i]
+		if v.Pre == "" {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+	}
+	parts := strings.Split(t, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 depending on whether
+// v is less than, equal to or greater than w.
+// A pre-release sorts before the release it precedes.
+func (v Version) Compare(w Version) int {
+	switch {
+	case v.Major != w.Major:
+		return cmp(v.Major, w.Major)
+	case v.Minor != w.Minor:
+		return cmp(v.Minor, w.Minor)
+	case v.Patch != w.Patch:
+		return cmp(v.Patch, w.Patch)
+	case v.Pre == w.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case w.Pre == "":
+		return -1
+	case v.Pre < w.Pre:
+		return -1
+	}
+	return 1
+}
+
+// Less reports whether v sorts before w.
+func (v Version) Less(w Version) bool {
+	return v.Compare(w) < 0
+}
+
+func cmp(a, b int) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// A Constraint is a set of version ranges, all of which
+// a version must satisfy.
+type Constraint struct {
+	text   string
+	ranges []versionRange
+}
+
+// versionRange is the interval [min, max).
+// A nil bound means the range is unbounded on that side.
+type versionRange struct {
+	min, max *Version
+	excmin   bool // min itself is not in the range
+	incmax   bool // max itself is in the range
+}
+
+// ParseConstraint parses a whitespace or comma separated list of
+// ranges. Each range is one of
+//
+//	1.2.3    exactly v1.2.3 (also "=1.2.3")
+//	^1.2     compatible with v1.2: >=v1.2.0, <v2.0.0
+//	~1.2     approximately v1.2: >=v1.2.0, <v1.3.0
+//	>=1.2    >1.2    <=1.2    <1.2
+//	1.x      any v1 release
+//	*        any version
+//
+// ^0.x constraints follow the usual convention that a zero major
+// version promises compatibility only within a minor version, and
+// ^0.0.x ones that a zero minor version promises none: ^0.0.3 means
+// >=v0.0.3, <v0.0.4.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return Constraint{}, fmt.Errorf("empty version constraint")
+	}
+	for _, f := range fields {
+		r, err := parseRange(f)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q: %v", s, err)
+		}
+		c.ranges = append(c.ranges, r)
+	}
+	return c, nil
+}
+
+func parseRange(s string) (versionRange, error) {
+	if s == "*" {
+		return versionRange{}, nil
+	}
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, s[len(o):]
+			break
+		}
+	}
+	if op == "" && (strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".*")) {
+		op, s = "x", s[:len(s)-2]
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return versionRange{}, err
+	}
+	parts := len(strings.Split(strings.SplitN(strings.TrimPrefix(s, "v"), "-", 2)[0], "."))
+	switch op {
+	case "", "=":
+		return versionRange{min: &v, max: &v, incmax: true}, nil
+	case ">=":
+		return versionRange{min: &v}, nil
+	case ">":
+		return versionRange{min: &v, excmin: true}, nil
+	case "<=":
+		return versionRange{max: &v, incmax: true}, nil
+	case "<":
+		return versionRange{max: &v}, nil
+	case "^":
+		max := Version{Major: v.Major + 1}
+		if v.Major == 0 && v.Minor == 0 && parts > 2 {
+			max = Version{Patch: v.Patch + 1}
+		} else if v.Major == 0 && parts > 1 {
+			max = Version{Minor: v.Minor + 1}
+		}
+		return versionRange{min: &v, max: &max}, nil
+	case "~", "x":
+		max := Version{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			max = Version{Major: v.Major + 1}
+		}
+		return versionRange{min: &v, max: &max}, nil
+	}
+	panic("unreachable")
+}
+
+func (r versionRange) contains(v Version) bool {
+	if r.min != nil {
+		c := v.Compare(*r.min)
+		if c < 0 || (c == 0 && r.excmin) {
+			return false
+		}
+	}
+	if r.max != nil {
+		c := v.Compare(*r.max)
+		if c > 0 || (c == 0 && !r.incmax) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check reports whether v satisfies c.
+func (c Constraint) Check(v Version) bool {
+	for _, r := range c.ranges {
+		if !r.contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) String() string {
+	return c.text
+}
+
+// Highest returns the highest release version among names that
+// satisfies c, or false if there is none. Names that aren't
+// versions, and pre-releases, are skipped. A nil c matches any
+// version. Of names for the same version, such as v1.2.0 and
+// 1.2.0, the greatest string wins, whatever the order of names.
+func Highest(names []string, c *Constraint) (string, bool) {
+	var best string
+	var bestv Version
+	for _, name := range names {
+		v, err := Parse(name)
+		if err != nil || v.Pre != "" || (c != nil && !c.Check(v)) {
+			continue
+		}
+		if best == "" || bestv.Less(v) || (!v.Less(bestv) && name > best) {
+			best, bestv = name, v
+		}
+	}
+	return best, best != ""
+}
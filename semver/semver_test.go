@@ -0,0 +1,132 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+		werr bool
+	}{
+		{s: "v1.2.3", want: "v1.2.3"},
+		{s: "1.2.3", want: "v1.2.3"},
+		{s: "v1.2", want: "v1.2.0"},
+		{s: "v1", want: "v1.0.0"},
+		{s: "v2.0.0-rc1", want: "v2.0.0-rc1"},
+		{s: "v1.0.0+build5", want: "v1.0.0"},
+		{s: "release", werr: true},
+		{s: "v1.2.3.4", werr: true},
+		{s: "v1.2-", werr: true},
+	}
+	for _, test := range cases {
+		v, err := Parse(test.s)
+		if g := err != nil; g != test.werr {
+			t.Errorf("Parse(%q) err = %v want error %v", test.s, err, test.werr)
+			continue
+		}
+		if err == nil && v.String() != test.want {
+			t.Errorf("Parse(%q) = %s want %s", test.s, v, test.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.0.0-rc1", "v1.0.0", -1},
+		{"v1.0.0-rc1", "v1.0.0-rc2", -1},
+	}
+	for _, test := range cases {
+		a, _ := Parse(test.a)
+		b, _ := Parse(test.b)
+		if g := a.Compare(b); g != test.want {
+			t.Errorf("%s.Compare(%s) = %d want %d", test.a, test.b, g, test.want)
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	cases := []struct {
+		c    string
+		v    string
+		want bool
+	}{
+		{"^1.2", "v1.2.0", true},
+		{"^1.2", "v1.9.3", true},
+		{"^1.2", "v1.1.9", false},
+		{"^1.2", "v2.0.0", false},
+		{"^0.3", "v0.3.5", true},
+		{"^0.3", "v0.4.0", false},
+		{"^0.0.3", "v0.0.3", true},
+		{"^0.0.3", "v0.0.4", false},
+		{"^0.0", "v0.0.9", true},
+		{"^0.0", "v0.1.0", false},
+		{"~0.3", "v0.3.9", true},
+		{"~0.3", "v0.4.0", false},
+		{"~1", "v1.8.0", true},
+		{"1.x", "v1.8.0", true},
+		{"1.x", "v2.0.0", false},
+		{"1.2.3", "v1.2.3", true},
+		{"=1.2.3", "v1.2.4", false},
+		{">=1.2, <1.4", "v1.3.0", true},
+		{">=1.2 <1.4", "v1.4.0", false},
+		{">1.2", "v1.2.0", false},
+		{">1.2", "v1.2.1", true},
+		{"<=1.2", "v1.2.0", true},
+		{"*", "v0.0.1", true},
+	}
+	for _, test := range cases {
+		c, err := ParseConstraint(test.c)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) = %v", test.c, err)
+			continue
+		}
+		v, _ := Parse(test.v)
+		if g := c.Check(v); g != test.want {
+			t.Errorf("ParseConstraint(%q).Check(%s) = %v want %v", test.c, test.v, g, test.want)
+		}
+	}
+	for _, s := range []string{"", "^", "~x.y", ">=1.2 foo"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestHighest(t *testing.T) {
+	names := []string{"v1.0.0", "v1.2.0", "release-5", "v1.10.1", "v2.0.0-rc1", "v0.9.0"}
+	cases := []struct {
+		c    string
+		want string
+	}{
+		{"", "v1.10.1"},
+		{"~1.2", "v1.2.0"},
+		{"^0.9", "v0.9.0"},
+		{"^2", ""},
+	}
+	for _, test := range cases {
+		var c *Constraint
+		if test.c != "" {
+			con, err := ParseConstraint(test.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c = &con
+		}
+		g, ok := Highest(names, c)
+		if g != test.want || ok != (test.want != "") {
+			t.Errorf("Highest(%q) = %q, %v want %q", test.c, g, ok, test.want)
+		}
+	}
+	for _, names := range [][]string{{"1.2.0", "v1.2.0"}, {"v1.2.0", "1.2.0"}} {
+		if g, _ := Highest(names, nil); g != "v1.2.0" {
+			t.Errorf("Highest(%q) = %q, want v1.2.0", names, g)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/azylman/govend/vend"
+
+var cmdUnrewrite = &Command{
+	Name:  "unrewrite",
+	Short: "undo -r, changing vendored import paths back to their original form",
+	Run:   runUnrewrite,
+}
+
+var unrewriteProfile string
+
+func init() {
+	cmdUnrewrite.Flag.StringVar(&unrewriteProfile, "profile", "", "undo -r for the `profile` named in Govend.toml")
+}
+
+func runUnrewrite(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	var vendor string
+	if unrewriteProfile != "" {
+		p, err := lookupProfile(unrewriteProfile)
+		if err != nil {
+			return err
+		}
+		vendor = p.Vendor
+	}
+	return vend.Unrewrite(vendor)
+}
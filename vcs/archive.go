@@ -0,0 +1,296 @@
+package vcs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An Archive is a snapshot of repositories, keyed by repo root
+// and revision, laid out as the directory tree
+//
+//	<root>/<rev>/<files of the repo at rev>
+//
+// It stands in for a VCS where there is no network: revisions
+// can be exported from an archive and added to it, but nothing
+// can be fetched. The repos in it are read with the "archive"
+// VCS, as returned by RepoRoot. An archive is stored either as
+// that directory tree or as a gzipped tarball of it.
+type Archive struct {
+	Dir string
+
+	tmp bool // Dir was extracted from a tarball
+}
+
+// isTarball reports whether the archive at path is stored as a tarball.
+func isTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// OpenArchive opens the archive stored at path.
+// Tarballs are extracted to a temporary directory,
+// which is removed by Close.
+func OpenArchive(path string) (*Archive, error) {
+	if !isTarball(path) {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return &Archive{Dir: path}, nil
+	}
+	dir, err := ioutil.TempDir("", "govend-archive")
+	if err != nil {
+		return nil, err
+	}
+	if err := extract(dir, path); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("reading archive %s: %v", path, err)
+	}
+	return &Archive{Dir: dir, tmp: true}, nil
+}
+
+// Close releases the resources held by a.
+func (a *Archive) Close() error {
+	if a.tmp {
+		return os.RemoveAll(a.Dir)
+	}
+	return nil
+}
+
+func (a *Archive) repoDir(root string) string {
+	return filepath.Join(a.Dir, filepath.FromSlash(root))
+}
+
+func (a *Archive) revDir(root, rev string) string {
+	return filepath.Join(a.repoDir(root), rev)
+}
+
+// RepoRoot returns the repo at root in a. Its Repo is the
+// directory to pass to the methods of its VCS.
+func (a *Archive) RepoRoot(root string) *RepoRoot {
+	return &RepoRoot{VCS: vcsArchive, Repo: a.repoDir(root), Root: root}
+}
+
+// Exists reports whether a has revision rev of the repo at root.
+func (a *Archive) Exists(root, rev string) bool {
+	return vcsArchive.Exists(a.repoDir(root), rev)
+}
+
+// Lookup returns the root of the repo holding revision rev
+// of importPath, or false if a doesn't have it.
+func (a *Archive) Lookup(importPath, rev string) (root string, ok bool) {
+	for root = importPath; root != "." && root != "/"; root = path.Dir(root) {
+		if a.Exists(root, rev) {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+// Export writes the files of revision rev of the repo at root to dst.
+func (a *Archive) Export(root, rev, dst string) error {
+	if !a.Exists(root, rev) {
+		return fmt.Errorf("archive has no revision %s of %s", rev, root)
+	}
+	return vcsArchive.Export(a.repoDir(root), rev, dst)
+}
+
+// Add records the files in src as revision rev of the repo at root.
+func (a *Archive) Add(root, rev, src string) error {
+	dst := a.revDir(root, rev)
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return copyTree(dst, src)
+}
+
+// Save stores a at path, as a tarball if path ends
+// in .tar.gz or .tgz and as a directory otherwise.
+func (a *Archive) Save(path string) error {
+	if !isTarball(path) {
+		if path == a.Dir {
+			return nil
+		}
+		return copyTree(path, a.Dir)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(a.Dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || name == a.Dir {
+			return err
+		}
+		rel, err := filepath.Rel(a.Dir, name)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		r, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	for _, c := range []io.Closer{tw, gz, f} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// extract unpacks the gzipped tarball at path into dir.
+func extract(dir, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return untar(dir, gz)
+}
+
+// untar unpacks the tarball read from r into dir. Entries outside
+// dir, symlinks leading out of it and writes through symlinks are
+// refused.
+func untar(dir string, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !within(dir, name) || hasDotDot(hdr.Name) {
+			return fmt.Errorf("invalid file name %q", hdr.Name)
+		}
+		if err := checkNoSymlinks(dir, name); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, 0777)
+		case tar.TypeSymlink:
+			target := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(target) || !within(dir, filepath.Join(filepath.Dir(name), target)) {
+				return fmt.Errorf("%s: symlink to %q leaves the archive", hdr.Name, hdr.Linkname)
+			}
+			err = os.Symlink(hdr.Linkname, name)
+		case tar.TypeReg:
+			err = writeFile(name, tr, os.FileMode(hdr.Mode))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// within reports whether name is dir or inside it.
+func within(dir, name string) bool {
+	return name == dir || strings.HasPrefix(name, dir+string(filepath.Separator))
+}
+
+func hasDotDot(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNoSymlinks returns an error if name, inside dir, or any
+// directory between them is a symlink, so that writing to name
+// can't end up elsewhere.
+func checkNoSymlinks(dir, name string) error {
+	for p := name; p != dir; p = filepath.Dir(p) {
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: refusing to write through symlink %s", name, p)
+		}
+	}
+	return nil
+}
+
+// copyTree copies the files in the directory src to dst.
+func copyTree(dst, src string) error {
+	return filepath.Walk(src, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, 0777)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		r, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return writeFile(target, r, fi.Mode())
+	})
+}
+
+func writeFile(name string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	w, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
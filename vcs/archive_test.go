@@ -0,0 +1,81 @@
+package vcs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTarball writes a gzipped tarball of hdrs to path, with
+// contents "x" for regular files.
+func writeTarball(t *testing.T, path string, hdrs []*tar.Header) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = 1
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte("x"))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+}
+
+func TestOpenArchiveSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		desc string
+		hdrs []*tar.Header
+		ok   bool
+	}{
+		{"link inside", []*tar.Header{
+			{Name: "D/d1/a.go", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "D/d1/b.go", Typeflag: tar.TypeSymlink, Linkname: "a.go"},
+		}, true},
+		{"absolute link", []*tar.Header{
+			{Name: "D/d1/link", Typeflag: tar.TypeSymlink, Linkname: dir},
+		}, false},
+		{"link out of archive", []*tar.Header{
+			{Name: "D/d1/link", Typeflag: tar.TypeSymlink, Linkname: "../../.."},
+		}, false},
+		{"write through link", []*tar.Header{
+			{Name: "D/d1/sub/a.go", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "D/d1/link", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+			{Name: "D/d1/link/b.go", Typeflag: tar.TypeReg, Mode: 0644},
+		}, false},
+		{"dot dot", []*tar.Header{
+			{Name: "D/../../x.go", Typeflag: tar.TypeReg, Mode: 0644},
+		}, false},
+	}
+	for _, test := range cases {
+		path := filepath.Join(dir, "bundle.tar.gz")
+		writeTarball(t, path, test.hdrs)
+		a, err := OpenArchive(path)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: OpenArchive err = %v, want ok %v", test.desc, err, test.ok)
+		}
+		if err == nil {
+			if !ByCmd("archive").Exists(a.RepoRoot("D").Repo, "d1") {
+				t.Errorf("%s: archive VCS can't find D d1", test.desc)
+			}
+			a.Close()
+		}
+	}
+}
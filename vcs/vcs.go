@@ -2,23 +2,50 @@ package vcs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
+	"github.com/azylman/govend/semver"
 	"golang.org/x/tools/go/vcs"
 )
 
+// ErrUnsupported is returned, wrapped, for operations
+// a version control system doesn't support.
+var ErrUnsupported = errors.New("unsupported")
+
 type VCS struct {
 	vcs *vcs.Cmd
 
 	identifyCmd string
 	describeCmd string
-	diffCmd     string
+	statusCmd   string
+	checkoutCmd string
+	remoteCmd   string
+	remotesCmd  string
+	unpushedCmd string
+
+	// run in bare repos
+	createBareCmd string
+	fetchCmd      string
+	headCmd       string
+	resolveCmd    string
+	exportCmd     string
+	logCmd        string
+	tagsCmd       string
+	exportTar     bool // exportCmd writes a tarball to stdout rather than files to {dst}.
 
 	// run in sandbox repos
 	existsCmd string
+
+	// Repositories are directories of an Archive, holding
+	// a snapshot of each revision, rather than VCS clones.
+	archive bool
 }
 
 var vcsBzr = &VCS{
@@ -26,15 +53,35 @@ var vcsBzr = &VCS{
 
 	identifyCmd: "version-info --custom --template {revision_id}",
 	describeCmd: "revno", // TODO(kr): find tag names if possible
-	diffCmd:     "diff -r {rev}",
+	statusCmd:   "status --short",
+	checkoutCmd: "update -r revid:{rev}",
+	remoteCmd:   "config parent_location",
+
+	createBareCmd: "branch --no-tree {repo} {dir}",
+	fetchCmd:      "pull --overwrite",
+	headCmd:       "version-info --custom --template {revision_id}",
+	exportCmd:     "export -r revid:{rev} {dst}",
 }
 
 var vcsGit = &VCS{
 	vcs: vcs.ByCmd("git"),
 
 	identifyCmd: "rev-parse HEAD",
-	describeCmd: "describe --tags",
-	diffCmd:     "diff {rev}",
+	describeCmd: "describe --tags {rev}",
+	statusCmd:   "status --porcelain --untracked-files=all",
+	checkoutCmd: "checkout -q {rev}",
+	remoteCmd:   "config remote.origin.url",
+	remotesCmd:  "remote",
+	unpushedCmd: "rev-list {rev} --not --remotes",
+
+	createBareCmd: "clone -q --mirror {repo} {dir}",
+	fetchCmd:      "fetch -q --prune --tags origin",
+	headCmd:       "rev-parse HEAD",
+	resolveCmd:    "rev-parse --verify {rev}^{commit}",
+	exportCmd:     "archive --format=tar {rev}",
+	exportTar:     true,
+	logCmd:        "log --format=%H%x09%s {from}..{to}",
+	tagsCmd:       "for-each-ref --format=%(objectname)%09%(*objectname)%09%(refname:short) refs/tags",
 
 	existsCmd: "cat-file -e {rev}",
 }
@@ -43,10 +90,29 @@ var vcsHg = &VCS{
 	vcs: vcs.ByCmd("hg"),
 
 	identifyCmd: "identify --id --debug",
-	describeCmd: "log -r . --template {latesttag}-{latesttagdistance}",
-	diffCmd:     "diff -r {rev}",
+	describeCmd: "log -r {rev} --template {latesttag}-{latesttagdistance}",
+	statusCmd:   "status",
+	checkoutCmd: "update -r {rev}",
+	remoteCmd:   "paths default",
+	remotesCmd:  "paths",
+	unpushedCmd: "log -r reverse(draft()&::{rev}) --template {node}\\n",
 
-	existsCmd: "cat -r {rev} .",
+	createBareCmd: "clone -q -U {repo} {dir}",
+	fetchCmd:      "pull -q",
+	headCmd:       "identify --id --debug -r default",
+	resolveCmd:    "identify --id --debug -r {rev}",
+	exportCmd:     "archive -r {rev} -t files {dst}",
+	logCmd:        "log -r reverse(only({to},{from})) --template {node}\\t{desc|firstline}\\n",
+	tagsCmd:       "log -r tag() --template {node}\\t\\t{join(tags,'\\t')}\\n",
+
+	existsCmd: "log -q -r {rev}",
+}
+
+// vcsArchive reads repositories stored in an Archive. It can only
+// check for revisions and export them; there is nothing to fetch.
+var vcsArchive = &VCS{
+	vcs:     &vcs.Cmd{Name: "archive"},
+	archive: true,
 }
 
 var cmd = map[*vcs.Cmd]*VCS{
@@ -55,6 +121,15 @@ var cmd = map[*vcs.Cmd]*VCS{
 	vcsHg.vcs:  vcsHg,
 }
 
+// ByCmd returns the VCS for the given command name,
+// such as "git", or nil if it is not supported.
+func ByCmd(name string) *VCS {
+	if name == vcsArchive.vcs.Name {
+		return vcsArchive
+	}
+	return cmd[vcs.ByCmd(name)]
+}
+
 func FromDir(dir, srcRoot string) (*VCS, string, error) {
 	vcscmd, reporoot, err := vcs.FromDir(dir, srcRoot)
 	if err != nil {
@@ -62,21 +137,287 @@ func FromDir(dir, srcRoot string) (*VCS, string, error) {
 	}
 	vcsext := cmd[vcscmd]
 	if vcsext == nil {
-		return nil, "", fmt.Errorf("%s is unsupported: %s", vcscmd.Name, dir)
+		return nil, "", fmt.Errorf("%s is %w: %s", vcscmd.Name, ErrUnsupported, dir)
 	}
 	return vcsext, reporoot, nil
 }
 
-func FromImportPath(importPath string) (*VCS, error) {
+// FromImportPath returns the repository root for importPath,
+// at its canonical location.
+func FromImportPath(importPath string) (*RepoRoot, error) {
 	rr, err := vcs.RepoRootForImportPath(importPath, false)
 	if err != nil {
 		return nil, err
 	}
-	vcs := cmd[rr.VCS]
-	if vcs == nil {
-		return nil, fmt.Errorf("%s is unsupported: %s", rr.VCS.Name, importPath)
+	v := cmd[rr.VCS]
+	if v == nil {
+		return nil, fmt.Errorf("%s is %w: %s", rr.VCS.Name, ErrUnsupported, importPath)
+	}
+	return &RepoRoot{VCS: v, Repo: rr.Repo, Root: rr.Root}, nil
+}
+
+// RepoRoot describes where the repository holding
+// an import path lives, and where to fetch it from.
+type RepoRoot struct {
+	VCS  *VCS
+	Repo string // URL to fetch the repository from.
+	Root string // Import path of the repository root.
+}
+
+// RepoRootForImportPath returns the repository root for importPath.
+// If source is not empty, the repository is fetched from there
+// instead of its canonical location. source may be a URL, or the
+// import path of a fork, such as "github.com/me/y".
+func RepoRootForImportPath(importPath, source string) (*RepoRoot, error) {
+	rr, err := FromImportPath(importPath)
+	if err != nil {
+		return nil, err
+	}
+	if source != "" && isURL(source) {
+		rr.Repo = source
+	} else if source != "" {
+		srr, err := FromImportPath(source)
+		if err != nil {
+			return nil, fmt.Errorf("source for %s: %v", importPath, err)
+		}
+		rr.VCS, rr.Repo = srr.VCS, srr.Repo
+	}
+	return rr, nil
+}
+
+func isURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "git@")
+}
+
+// SameRepo reports whether the repository URLs or import
+// paths a and b refer to the same repository, ignoring
+// differences of scheme and a trailing ".git".
+// For example, "https://github.com/x/y.git",
+// "git@github.com:x/y" and "github.com/x/y" are all the same.
+func SameRepo(a, b string) bool {
+	return normRepo(a) == normRepo(b)
+}
+
+func normRepo(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+len("://"):]
+		if i := strings.Index(s, "@"); i >= 0 && i < strings.Index(s+"/", "/") {
+			s = s[i+1:] // user info
+		}
+	} else if strings.HasPrefix(s, "git@") {
+		s = strings.Replace(strings.TrimPrefix(s, "git@"), ":", "/", 1)
+	}
+	s = strings.TrimSuffix(s, "/")
+	return strings.TrimSuffix(s, ".git")
+}
+
+// Create clones the repository at repo into dir
+// and checks out rev.
+func (v *VCS) Create(dir, repo, rev string) error {
+	if err := v.vcs.Create(dir, repo); err != nil {
+		return err
+	}
+	return v.Checkout(dir, rev)
+}
+
+// Clone clones the repository at repo into dir, leaving
+// the tip of its default branch checked out.
+func (v *VCS) Clone(dir, repo string) error {
+	return v.vcs.Create(dir, repo)
+}
+
+// Checkout updates the working tree in dir to rev.
+func (v *VCS) Checkout(dir, rev string) error {
+	return v.run(dir, v.checkoutCmd, "rev", rev)
+}
+
+// Remote returns the URL the repository in dir was cloned from.
+func (v *VCS) Remote(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.remoteCmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// CreateBare clones the repository at repo into dir
+// without a working tree.
+func (v *VCS) CreateBare(dir, repo string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+		return err
+	}
+	return v.run(filepath.Dir(dir), v.createBareCmd, "repo", repo, "dir", dir)
+}
+
+// Exists reports whether the repository in dir has revision rev.
+func (v *VCS) Exists(dir, rev string) bool {
+	if v.archive {
+		fi, err := os.Stat(filepath.Join(dir, rev))
+		return err == nil && fi.IsDir()
+	}
+	if v.existsCmd == "" {
+		return false
+	}
+	_, err := v.runOutputVerboseOnly(dir, v.existsCmd, "rev", rev)
+	return err == nil
+}
+
+// Fetch pulls new revisions into the bare repository in dir.
+func (v *VCS) Fetch(dir string) error {
+	return v.run(dir, v.fetchCmd)
+}
+
+// Head returns the revision at the tip of the default
+// branch of the bare repository in dir.
+func (v *VCS) Head(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.headCmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// Resolve returns the ID of revision rev of the bare repository
+// in dir, where rev may be any name the VCS understands, such as
+// a tag or an abbreviated ID.
+func (v *VCS) Resolve(dir, rev string) (string, error) {
+	if v.resolveCmd == "" {
+		return "", fmt.Errorf("resolving revisions is %w for %s", ErrUnsupported, v.vcs.Name)
+	}
+	out, err := v.runOutput(dir, v.resolveCmd, "rev", rev)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// Export writes the files of revision rev of the bare
+// repository in dir to the directory dst.
+func (v *VCS) Export(dir, rev, dst string) error {
+	if v.archive {
+		if !v.Exists(dir, rev) {
+			return fmt.Errorf("archive has no revision %s in %s", rev, dir)
+		}
+		return copyTree(dst, filepath.Join(dir, rev))
+	}
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return err
+	}
+	if !v.exportTar {
+		return v.run(dir, v.exportCmd, "rev", rev, "dst", dst)
+	}
+	// Nothing is written to the repo, so exports can run at once.
+	cmd := exec.Command(v.vcs.Cmd, expandArgs(v.exportCmd, "rev", rev)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err = untar(dst, r)
+	io.Copy(ioutil.Discard, r)
+	if werr := cmd.Wait(); werr != nil {
+		return fmt.Errorf("%v: %s", werr, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return err
+}
+
+// A Commit is a revision in a repository's history.
+type Commit struct {
+	Rev     string
+	Subject string // First line of the commit message.
+}
+
+// Log returns the commits that are ancestors of revision to
+// but not of revision from, newest first, in the repository in dir.
+func (v *VCS) Log(dir, from, to string) ([]Commit, error) {
+	if v.logCmd == "" {
+		return nil, fmt.Errorf("log is %w for %s", ErrUnsupported, v.vcs.Name)
+	}
+	out, err := v.runOutput(dir, v.logCmd, "from", from, "to", to)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.SplitN(line, "\t", 2)
+		c := Commit{Rev: f[0]}
+		if len(f) > 1 {
+			c.Subject = f[1]
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// Between returns the commits of the repository in dir that moving
+// from revision from to revision to brings in, and those it takes
+// out, as when to is older than from or on another branch. Both
+// are newest first.
+func (v *VCS) Between(dir, from, to string) (in, out []Commit, err error) {
+	if in, err = v.Log(dir, from, to); err != nil {
+		return nil, nil, err
+	}
+	if out, err = v.Log(dir, to, from); err != nil {
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+// Tags returns the tags of the repository in dir,
+// keyed by the revision they point to.
+func (v *VCS) Tags(dir string) (map[string][]string, error) {
+	if v.tagsCmd == "" {
+		return nil, fmt.Errorf("listing tags is %w for %s", ErrUnsupported, v.vcs.Name)
+	}
+	out, err := v.runOutput(dir, v.tagsCmd)
+	if err != nil {
+		return nil, err
+	}
+	// Each line is the revision the tag points to, then the
+	// revision it peels to if it is an annotated tag,
+	// then the names of the tags.
+	tags := make(map[string][]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) < 3 {
+			continue
+		}
+		rev := f[0]
+		if f[1] != "" {
+			rev = f[1]
+		}
+		for _, name := range f[2:] {
+			if name != "tip" { // hg's name for the newest revision
+				tags[rev] = append(tags[rev], name)
+			}
+		}
 	}
-	return vcs, nil
+	return tags, nil
+}
+
+// HighestTag returns the highest semver tag in the repository in
+// dir that satisfies c, and the revision it points to. A nil c
+// matches any version.
+func (v *VCS) HighestTag(dir string, c *semver.Constraint) (tag, rev string, err error) {
+	tags, err := v.Tags(dir)
+	if err != nil {
+		return "", "", err
+	}
+	revs := make(map[string]string) // tag → rev
+	var names []string
+	for rev, ts := range tags {
+		for _, t := range ts {
+			revs[t] = rev
+			names = append(names, t)
+		}
+	}
+	tag, ok := semver.Highest(names, c)
+	if !ok {
+		if c != nil {
+			return "", "", fmt.Errorf("no version tag satisfies %s in %s", c, dir)
+		}
+		return "", "", fmt.Errorf("no version tags in %s", dir)
+	}
+	return tag, revs[tag], nil
 }
 
 func (v *VCS) Identify(dir string) (string, error) {
@@ -92,9 +433,73 @@ func (v *VCS) Describe(dir, rev string) string {
 	return string(bytes.TrimSpace(out))
 }
 
-func (v *VCS) IsDirty(dir, rev string) bool {
-	out, err := v.runOutput(dir, v.diffCmd, "rev", rev)
-	return err != nil || len(out) != 0
+// A Status describes the changes in a working tree that the
+// revision checked out doesn't capture, and the commits leading to
+// that revision that exist only in the local repository.
+type Status struct {
+	Modified  []string // Changed, added or removed files, as the VCS shows them.
+	Untracked []string
+	Unpushed  []string // Revisions on no remote, newest first.
+}
+
+// Clean reports whether s has nothing to report.
+func (s *Status) Clean() bool {
+	return len(s.Modified) == 0 && len(s.Untracked) == 0 && len(s.Unpushed) == 0
+}
+
+func (s *Status) String() string {
+	var parts []string
+	add := func(what string, list []string) {
+		if len(list) > 0 {
+			parts = append(parts, what+" "+strings.Join(list, ", "))
+		}
+	}
+	add("modified", s.Modified)
+	add("untracked", s.Untracked)
+	var revs []string
+	for _, rev := range s.Unpushed {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		revs = append(revs, rev)
+	}
+	add("unpushed", revs)
+	return strings.Join(parts, "; ")
+}
+
+// Status returns the status of the working tree in dir, which has
+// revision rev checked out. Unpushed commits are only looked for if
+// the repository has a remote, of any name, and the VCS can tell
+// which commits it has without contacting it.
+func (v *VCS) Status(dir, rev string) (*Status, error) {
+	out, err := v.runOutput(dir, v.statusCmd)
+	if err != nil {
+		return nil, err
+	}
+	st := new(Status)
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		file := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), f[0]))
+		if strings.Contains(f[0], "?") {
+			st.Untracked = append(st.Untracked, file)
+		} else {
+			st.Modified = append(st.Modified, file)
+		}
+	}
+	if v.unpushedCmd == "" {
+		return st, nil
+	}
+	if remotes, err := v.runOutputVerboseOnly(dir, v.remotesCmd); err != nil || len(bytes.TrimSpace(remotes)) == 0 {
+		return st, nil
+	}
+	if out, err = v.runOutput(dir, v.unpushedCmd, "rev", rev); err != nil {
+		return nil, err
+	}
+	st.Unpushed = strings.Fields(string(out))
+	return st, nil
 }
 
 // run runs the command line cmd in the given directory.
@@ -121,14 +526,10 @@ func (v *VCS) runOutputVerboseOnly(dir string, cmdline string, kv ...string) ([]
 
 // run1 is the generalized implementation of run and runOutput.
 func (v *VCS) run1(dir string, cmdline string, kv []string, verbose bool) ([]byte, error) {
-	m := make(map[string]string)
-	for i := 0; i < len(kv); i += 2 {
-		m[kv[i]] = kv[i+1]
-	}
-	args := strings.Fields(cmdline)
-	for i, arg := range args {
-		args[i] = expand(m, arg)
+	if cmdline == "" {
+		return nil, fmt.Errorf("%w for %s", ErrUnsupported, v.vcs.Name)
 	}
+	args := expandArgs(cmdline, kv...)
 
 	_, err := exec.LookPath(v.vcs.Cmd)
 	if err != nil {
@@ -153,6 +554,20 @@ func (v *VCS) run1(dir string, cmdline string, kv []string, verbose bool) ([]byt
 	return out, nil
 }
 
+// expandArgs splits cmdline into arguments and expands
+// them, as described for run.
+func expandArgs(cmdline string, kv ...string) []string {
+	m := make(map[string]string)
+	for i := 0; i < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+	args := strings.Fields(cmdline)
+	for i, arg := range args {
+		args[i] = expand(m, arg)
+	}
+	return args
+}
+
 func expand(m map[string]string, s string) string {
 	for k, v := range m {
 		s = strings.Replace(s, "{"+k+"}", v, -1)
@@ -0,0 +1,158 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSameRepo(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"github.com/x/y", "github.com/x/y", true},
+		{"https://github.com/x/y.git", "github.com/x/y", true},
+		{"git@github.com:x/y", "github.com/x/y", true},
+		{"ssh://git@github.com/x/y.git", "https://github.com/x/y/", true},
+		{"https://github.com/me/y", "github.com/x/y", false},
+		{"https://bitbucket.org/x/y", "github.com/x/y", false},
+	}
+	for _, test := range cases {
+		if g := SameRepo(test.a, test.b); g != test.want {
+			t.Errorf("SameRepo(%q, %q) = %v want %v", test.a, test.b, g, test.want)
+		}
+	}
+}
+
+func TestLogAndTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	var revs []string
+	for _, msg := range []string{"one", "two", "three"} {
+		git("commit", "-q", "--allow-empty", "-m", msg+"\n\nbody")
+		revs = append(revs, git("rev-parse", "HEAD"))
+	}
+	git("tag", "v1.0.0", revs[0])
+	git("tag", "-a", "-m", "release", "v1.1.0", revs[1])
+
+	v := ByCmd("git")
+	commits, err := v.Log(dir, revs[0], "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Commit{{revs[2], "three"}, {revs[1], "two"}}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("Log = %v want %v", commits, want)
+	}
+
+	in, out, err := v.Between(dir, revs[1], revs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in) != 0 || !reflect.DeepEqual(out, []Commit{{revs[1], "two"}}) {
+		t.Errorf("Between = %v, %v want [], [two]", in, out)
+	}
+
+	tags, err := v.Tags(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wtags := map[string][]string{revs[0]: {"v1.0.0"}, revs[1]: {"v1.1.0"}}
+	if !reflect.DeepEqual(tags, wtags) {
+		t.Errorf("Tags = %v want %v", tags, wtags)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	upstream, clone := filepath.Join(dir, "upstream"), filepath.Join(dir, "clone")
+	if err := os.Mkdir(upstream, 0777); err != nil {
+		t.Fatal(err)
+	}
+	git(upstream, "init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(upstream, "a.go"), []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git(upstream, "add", "a.go")
+	git(upstream, "commit", "-q", "-m", "one")
+	git(dir, "clone", "-q", upstream, clone)
+
+	v := ByCmd("git")
+	st, err := v.Status(clone, git(clone, "rev-parse", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Clean() {
+		t.Errorf("Status of fresh clone = %v, want clean", st)
+	}
+
+	git(clone, "commit", "-q", "--allow-empty", "-m", "two")
+	rev := git(clone, "rev-parse", "HEAD")
+	if err := ioutil.WriteFile(filepath.Join(clone, "a.go"), []byte("package b\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(clone, "b.go"), []byte("package a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	st, err = v.Status(clone, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Status{Modified: []string{"a.go"}, Untracked: []string{"b.go"}, Unpushed: []string{rev}}
+	if !reflect.DeepEqual(st, want) {
+		t.Errorf("Status = %+v want %+v", st, want)
+	}
+	if g, w := st.String(), "modified a.go; untracked b.go; unpushed "+rev[:12]; g != w {
+		t.Errorf("Status.String() = %q want %q", g, w)
+	}
+
+	// Any remote will do, not just origin.
+	git(clone, "remote", "rename", "origin", "upstream")
+	st, err = v.Status(clone, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(st.Unpushed, []string{rev}) {
+		t.Errorf("Status.Unpushed with remote upstream = %v want [%s]", st.Unpushed, rev)
+	}
+
+	// Without a remote, nothing can be pushed.
+	st, err = v.Status(upstream, git(upstream, "rev-parse", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Clean() {
+		t.Errorf("Status of repo without remote = %v, want clean", st)
+	}
+}
@@ -0,0 +1,216 @@
+package vend
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/vcs"
+)
+
+// A RepoLog is the history of a repo between the revisions an
+// update moved its dependencies from and to.
+type RepoLog struct {
+	Root        string   // Import path of the repo root.
+	ImportPaths []string // The dependencies in it.
+	OldRev      string
+	NewRev      string
+	OldVersion  string       `json:",omitempty"` // Tag, or else description, of OldRev.
+	NewVersion  string       `json:",omitempty"` // Likewise for NewRev.
+	Commits     []vcs.Commit // Brought in by the update, newest first.
+	Reverted    []vcs.Commit `json:",omitempty"` // Taken out by it, newest first.
+
+	// Tags of the commits in Commits and Reverted, by revision.
+	Tags map[string][]string `json:",omitempty"`
+}
+
+// changelog returns the history of the repo of each of deps, the
+// updated dependencies, since the revision of the dependency in old.
+// Repos are read from c, if not nil, and from GOPATH otherwise. A
+// repo whose history can't be read is logged and has no commits.
+func changelog(c *cache.Cache, old, deps []pkgs.Dependency) []RepoLog {
+	var logs []RepoLog
+	byRoot := make(map[string]int) // index in logs
+	for _, dep := range deps {
+		i := depIndex(old, dep.ImportPath)
+		if i < 0 || old[i].Rev == dep.Rev {
+			continue
+		}
+		if j, ok := byRoot[dep.Root]; ok {
+			logs[j].ImportPaths = append(logs[j].ImportPaths, dep.ImportPath)
+			continue
+		}
+		rl := RepoLog{
+			Root:        dep.Root,
+			ImportPaths: []string{dep.ImportPath},
+			OldRev:      old[i].Rev,
+			NewRev:      dep.Rev,
+			OldVersion:  depVersion(old[i]),
+			NewVersion:  depVersion(dep),
+		}
+		if err := rl.load(c, dep); err != nil {
+			log.Printf("%s: cannot read history: %v", dep.Root, err)
+		}
+		byRoot[dep.Root] = len(logs)
+		logs = append(logs, rl)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Root < logs[j].Root })
+	return logs
+}
+
+// load fills in the commits and tags of rl from the repo of dep.
+func (rl *RepoLog) load(c *cache.Cache, dep pkgs.Dependency) error {
+	var v *vcs.VCS
+	var dir string
+	if c != nil {
+		rr, err := vcs.RepoRootForImportPath(dep.ImportPath, dep.Source)
+		if err != nil {
+			return err
+		}
+		if dir, err = c.Fetch(rr); err != nil {
+			return err
+		}
+		v = rr.VCS
+	} else {
+		srcRoot := filepath.Join(dep.Workspace, "src")
+		var reporoot string
+		var err error
+		if v, reporoot, err = vcs.FromDir(dep.Dir, srcRoot); err != nil {
+			return err
+		}
+		dir = filepath.Join(srcRoot, reporoot)
+	}
+	in, out, err := v.Between(dir, rl.OldRev, rl.NewRev)
+	if err != nil {
+		return err
+	}
+	rl.Commits, rl.Reverted = in, out
+	tags, err := v.Tags(dir)
+	if err != nil {
+		return err
+	}
+	for _, commit := range append(append([]vcs.Commit{}, in...), out...) {
+		if t := tags[commit.Rev]; len(t) > 0 {
+			if rl.Tags == nil {
+				rl.Tags = make(map[string][]string)
+			}
+			sort.Strings(t)
+			rl.Tags[commit.Rev] = t
+		}
+	}
+	return nil
+}
+
+// depVersion returns the tag dep was chosen from, or else the
+// description of its revision.
+func depVersion(dep pkgs.Dependency) string {
+	if dep.Tag != "" {
+		return dep.Tag
+	}
+	return dep.Comment
+}
+
+// WriteChangelog writes logs to w as Markdown, suitable for the
+// description of a pull request.
+func WriteChangelog(w io.Writer, logs []RepoLog) error {
+	var b strings.Builder
+	for i, rl := range logs {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		links := webLinks(rl.Root)
+		fmt.Fprintf(&b, "### %s\n\n", rl.Root)
+		var paths []string
+		for _, p := range rl.ImportPaths {
+			paths = append(paths, "`"+p+"`")
+		}
+		fmt.Fprintf(&b, "Updated %s from %s to %s", strings.Join(paths, ", "),
+			revLabel(rl.OldVersion, rl.OldRev), revLabel(rl.NewVersion, rl.NewRev))
+		if links != nil && links.compare != nil {
+			fmt.Fprintf(&b, " ([compare](%s))", links.compare(rl.OldRev, rl.NewRev))
+		}
+		b.WriteString(".\n")
+		writeCommits(&b, "", rl.Commits, rl.Tags, links)
+		writeCommits(&b, "Reverted:", rl.Reverted, rl.Tags, links)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeCommits(b *strings.Builder, heading string, commits []vcs.Commit, tags map[string][]string, links *hostLinks) {
+	if len(commits) == 0 {
+		return
+	}
+	b.WriteString("\n")
+	if heading != "" {
+		b.WriteString(heading + "\n\n")
+	}
+	for _, c := range commits {
+		rev := "`" + shortRev(c.Rev) + "`"
+		if links != nil {
+			rev = fmt.Sprintf("[%s](%s)", rev, links.commit(c.Rev))
+		}
+		fmt.Fprintf(b, "- %s %s", rev, c.Subject)
+		if t := tags[c.Rev]; len(t) > 0 {
+			fmt.Fprintf(b, " (%s)", strings.Join(t, ", "))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// revLabel describes a revision by its version, if any, and its ID.
+func revLabel(version, rev string) string {
+	if version == "" {
+		return "`" + shortRev(rev) + "`"
+	}
+	return version + " (`" + shortRev(rev) + "`)"
+}
+
+// shortRev abbreviates a revision ID for display.
+func shortRev(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
+
+// hostLinks makes links to the web pages of a repo.
+type hostLinks struct {
+	commit  func(rev string) string
+	compare func(from, to string) string // Nil if the host has no such page.
+}
+
+// webLinks returns links for the repo with import path root,
+// or nil if it isn't on a host we know.
+func webLinks(root string) *hostLinks {
+	f := strings.Split(root, "/")
+	switch {
+	case len(f) == 3 && (f[0] == "github.com" || f[0] == "gitlab.com"):
+		base := "https://" + root
+		sep := "/"
+		if f[0] == "gitlab.com" {
+			sep = "/-/"
+		}
+		return &hostLinks{
+			commit:  func(rev string) string { return base + sep + "commit/" + rev },
+			compare: func(from, to string) string { return base + sep + "compare/" + from + "..." + to },
+		}
+	case len(f) == 3 && f[0] == "bitbucket.org":
+		base := "https://" + root
+		return &hostLinks{
+			commit: func(rev string) string { return base + "/commits/" + rev },
+		}
+	case len(f) == 3 && f[0] == "golang.org" && f[1] == "x":
+		base := "https://go.googlesource.com/" + f[2]
+		return &hostLinks{
+			commit:  func(rev string) string { return base + "/+/" + rev },
+			compare: func(from, to string) string { return base + "/+log/" + from + ".." + to },
+		}
+	}
+	return nil
+}
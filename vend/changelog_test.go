@@ -0,0 +1,79 @@
+package vend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/azylman/govend/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteChangelog(t *testing.T) {
+	logs := []RepoLog{
+		{
+			Root:        "example.com/x",
+			ImportPaths: []string{"example.com/x"},
+			OldRev:      "1111111111111111",
+			NewRev:      "2222222222222222",
+			Commits:     []vcs.Commit{{Rev: "2222222222222222", Subject: "Fix it"}},
+		},
+		{
+			Root:        "github.com/x/y",
+			ImportPaths: []string{"github.com/x/y", "github.com/x/y/z"},
+			OldRev:      "aaaaaaaaaaaaaaaa",
+			NewRev:      "bbbbbbbbbbbbbbbb",
+			OldVersion:  "v1.0.0",
+			NewVersion:  "v1.1.0",
+			Commits:     []vcs.Commit{{Rev: "bbbbbbbbbbbbbbbb", Subject: "Release"}, {Rev: "cccccccccccccccc", Subject: "Add z"}},
+			Reverted:    []vcs.Commit{{Rev: "dddddddddddddddd", Subject: "Hotfix"}},
+			Tags:        map[string][]string{"bbbbbbbbbbbbbbbb": {"v1.1.0"}},
+		},
+	}
+	want := "### example.com/x\n" +
+		"\n" +
+		"Updated `example.com/x` from `111111111111` to `222222222222`.\n" +
+		"\n" +
+		"- `222222222222` Fix it\n" +
+		"\n" +
+		"### github.com/x/y\n" +
+		"\n" +
+		"Updated `github.com/x/y`, `github.com/x/y/z` from v1.0.0 (`aaaaaaaaaaaa`) to v1.1.0 (`bbbbbbbbbbbb`)" +
+		" ([compare](https://github.com/x/y/compare/aaaaaaaaaaaaaaaa...bbbbbbbbbbbbbbbb)).\n" +
+		"\n" +
+		"- [`bbbbbbbbbbbb`](https://github.com/x/y/commit/bbbbbbbbbbbbbbbb) Release (v1.1.0)\n" +
+		"- [`cccccccccccc`](https://github.com/x/y/commit/cccccccccccccccc) Add z\n" +
+		"\n" +
+		"Reverted:\n" +
+		"\n" +
+		"- [`dddddddddddd`](https://github.com/x/y/commit/dddddddddddddddd) Hotfix\n"
+	var buf bytes.Buffer
+	assert.Nil(t, WriteChangelog(&buf, logs))
+	assert.Equal(t, want, buf.String())
+}
+
+func TestWebLinks(t *testing.T) {
+	cases := []struct {
+		root    string
+		commit  string
+		compare string
+	}{
+		{"github.com/x/y", "https://github.com/x/y/commit/b", "https://github.com/x/y/compare/a...b"},
+		{"gitlab.com/x/y", "https://gitlab.com/x/y/-/commit/b", "https://gitlab.com/x/y/-/compare/a...b"},
+		{"bitbucket.org/x/y", "https://bitbucket.org/x/y/commits/b", ""},
+		{"golang.org/x/net", "https://go.googlesource.com/net/+/b", "https://go.googlesource.com/net/+log/a..b"},
+		{"example.com/x/y", "", ""},
+	}
+	for _, test := range cases {
+		links := webLinks(test.root)
+		if links == nil {
+			assert.Equal(t, "", test.commit, test.root)
+			continue
+		}
+		assert.Equal(t, test.commit, links.commit("b"), test.root)
+		if links.compare == nil {
+			assert.Equal(t, "", test.compare, test.root)
+		} else {
+			assert.Equal(t, test.compare, links.compare("a", "b"), test.root)
+		}
+	}
+}
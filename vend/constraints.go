@@ -0,0 +1,239 @@
+package vend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/semver"
+)
+
+// ConstraintsFile is the hand-edited file, in the package directory,
+// that expresses intent about dependencies. Deps.json remains the
+// record of what was actually resolved.
+const ConstraintsFile = "Govend.toml"
+
+// Constraints is the contents of the constraints file, e.g.
+//
+//	[[constraint]]
+//	pattern = "github.com/foo/..."
+//	version = "^1.2"
+//
+//	[[constraint]]
+//	pattern = "github.com/bar/..."
+//	ignore = true
+//
+//	[[constraint]]
+//	pattern = "github.com/x/y/..."
+//	source = "github.com/me/y"
+//
+//	[[profile]]
+//	name = "api"
+//	packages = ["./cmd/api/..."]
+//	vendor = "cmd/api/vendor"
+type Constraints struct {
+	Constraint []Constraint `toml:"constraint"`
+	Profile    []Profile    `toml:"profile"`
+}
+
+// A Constraint applies to all dependencies whose import
+// path matches Pattern. When several constraints match
+// a dependency, the first one in the file wins.
+type Constraint struct {
+	Pattern string `toml:"pattern"`
+	Version string `toml:"version"` // Semver range the dependency's tag must satisfy.
+	Ignore  bool   `toml:"ignore"`  // Never vendor matching packages.
+	Source  string `toml:"source"`  // Alternate location to fetch the repo from.
+
+	version *semver.Constraint
+	pattern pkgs.Pattern // Pattern, parsed, for ignore constraints.
+}
+
+// A Profile is a named set of packages vendored together, with
+// its own vendor directory and manifest, for trees holding several
+// programs that need different dependencies.
+type Profile struct {
+	Name     string   `toml:"name"`
+	Packages []string `toml:"packages"` // Patterns of the packages to save.
+	Vendor   string   `toml:"vendor"`   // Vendor directory, relative to the package directory.
+}
+
+// ReadConstraints reads the constraints file at path.
+// A missing file is the same as an empty one.
+func ReadConstraints(path string) (*Constraints, error) {
+	c := new(Constraints)
+	if _, err := toml.DecodeFile(path, c); err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	for i := range c.Constraint {
+		con := &c.Constraint[i]
+		if con.Pattern == "" {
+			return nil, fmt.Errorf("%s: constraint %d has no pattern", path, i+1)
+		}
+		if con.Version != "" {
+			v, err := semver.ParseConstraint(con.Version)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, con.Pattern, err)
+			}
+			con.version = &v
+		}
+		if con.Ignore {
+			p, err := pkgs.ParsePattern(con.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			con.pattern = p
+		}
+	}
+	seen := make(map[string]bool)
+	for i, p := range c.Profile {
+		switch {
+		case p.Name == "":
+			return nil, fmt.Errorf("%s: profile %d has no name", path, i+1)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("%s: duplicate profile %s", path, p.Name)
+		case len(p.Packages) == 0:
+			return nil, fmt.Errorf("%s: profile %s has no packages", path, p.Name)
+		case filepath.IsAbs(p.Vendor) || filepath.Base(p.Vendor) != srcdir:
+			return nil, fmt.Errorf("%s: profile %s: vendor must be a relative path ending in %s", path, p.Name, srcdir)
+		case escapes(p.Vendor):
+			return nil, fmt.Errorf("%s: profile %s: vendor must be inside the package directory", path, p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return c, nil
+}
+
+// escapes reports whether the relative path rel
+// leads outside the directory it is relative to.
+func escapes(rel string) bool {
+	rel = filepath.Clean(rel)
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// LookupProfile returns the profile called name.
+func (c *Constraints) LookupProfile(name string) (*Profile, error) {
+	for i := range c.Profile {
+		if c.Profile[i].Name == name {
+			return &c.Profile[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no profile %s in %s", name, ConstraintsFile)
+}
+
+// match returns the constraint for importPath, or nil if there is none.
+func (c *Constraints) match(importPath string) *Constraint {
+	for i := range c.Constraint {
+		if pkgs.Match(c.Constraint[i].Pattern, importPath) {
+			return &c.Constraint[i]
+		}
+	}
+	return nil
+}
+
+// source returns the source constraint for importPath,
+// or "" if there is none.
+func (c *Constraints) source(importPath string) string {
+	if con := c.match(importPath); con != nil {
+		return con.Source
+	}
+	return ""
+}
+
+// ignores returns the patterns of all ignore constraints.
+func (c *Constraints) ignores() pkgs.Patterns {
+	var pats pkgs.Patterns
+	for _, con := range c.Constraint {
+		if con.Ignore {
+			pats = append(pats, con.pattern)
+		}
+	}
+	return pats
+}
+
+// ignorePatterns parses the ignore list of the manifest g and
+// adds the ignore constraints in c.
+func ignorePatterns(g *Manifest, c *Constraints) (pkgs.Patterns, error) {
+	pats, err := pkgs.ParsePatterns(g.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("ignore list: %v", err)
+	}
+	return append(pats, c.ignores()...), nil
+}
+
+// apply fills in the source overrides for deps. A Source already
+// recorded in the manifest is kept unless a constraint gives another.
+// It returns an error if any dependency's version doesn't satisfy
+// its constraint.
+func (c *Constraints) apply(deps []pkgs.Dependency) error {
+	for i := range deps {
+		dep := &deps[i]
+		con := c.match(dep.ImportPath)
+		if con == nil {
+			continue
+		}
+		if con.version != nil {
+			tag, exact := DescribeTag(dep.Comment)
+			v, err := semver.Parse(tag)
+			if err != nil || !exact {
+				return fmt.Errorf("%s: no version tag at %s, want %s", dep.ImportPath, dep.Rev, con.version)
+			}
+			if !con.version.Check(v) {
+				return fmt.Errorf("%s: %s does not satisfy %s", dep.ImportPath, v, con.version)
+			}
+		}
+		if con.Source != "" {
+			dep.Source = con.Source
+		}
+	}
+	return nil
+}
+
+// tagConstraint returns a function giving the constraint the tag
+// of each dependency must satisfy when updating to tags: version,
+// if it's not empty, or else the dependency's version constraint.
+func (c *Constraints) tagConstraint(version string) (func(importPath string) *semver.Constraint, error) {
+	if version != "" {
+		v, err := semver.ParseConstraint(version)
+		if err != nil {
+			return nil, err
+		}
+		return func(string) *semver.Constraint { return &v }, nil
+	}
+	return func(importPath string) *semver.Constraint {
+		if con := c.match(importPath); con != nil {
+			return con.version
+		}
+		return nil
+	}, nil
+}
+
+// gitDescribeSuffix matches the suffix git describe adds when a
+// revision is ahead of the latest tag: the distance and the
+// abbreviated hash.
+var gitDescribeSuffix = regexp.MustCompile(`-[0-9]+-g[0-9a-f]+$`)
+
+// DescribeTag returns the tag named in the output of VCS.Describe,
+// and whether the revision described is the tagged one. For example,
+//
+//	DescribeTag("v1.2.0")             = "v1.2.0", true
+//	DescribeTag("v1.2.0-3-g1a2b3c4")  = "v1.2.0", false
+//	DescribeTag("v1.2.0-0")           = "v1.2.0", true
+//	DescribeTag("v1.2.0-1")           = "v1.2.0-1", true
+//
+// The last two are ambiguous: hg appends the distance from the
+// latest tag, but only a distance of 0 is taken as such, since a
+// numeric pre-release such as v1.2.0-1 looks the same.
+func DescribeTag(comment string) (tag string, exact bool) {
+	if loc := gitDescribeSuffix.FindStringIndex(comment); loc != nil {
+		return comment[:loc[0]], false
+	}
+	return strings.TrimSuffix(comment, "-0"), true
+}
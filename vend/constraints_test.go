@@ -0,0 +1,104 @@
+package vend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConstraintsProfileVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ConstraintsFile)
+
+	cases := []struct {
+		vendor string
+		werr   bool
+	}{
+		{"cmd/api/vendor", false},
+		{"vendor", false},
+		{"..x/vendor", false},
+		{"../x/vendor", true},
+		{"cmd/../../vendor", true},
+		{"/x/vendor", true},
+		{"cmd/api", true},
+	}
+	for _, test := range cases {
+		body := "[[profile]]\nname = \"api\"\npackages = [\"./cmd/api/...\"]\nvendor = \"" + test.vendor + "\"\n"
+		assert.Nil(t, ioutil.WriteFile(path, []byte(body), 0666))
+		_, err := ReadConstraints(path)
+		assert.Equal(t, test.werr, err != nil, test.vendor)
+	}
+}
+
+func TestDescribeTag(t *testing.T) {
+	cases := []struct {
+		comment, tag string
+		exact        bool
+	}{
+		{"v1.2.0", "v1.2.0", true},
+		{"v1.2.0-3-g1a2b3c4", "v1.2.0", false},
+		{"v1.2.0-1-g1a2b3c4", "v1.2.0", false},
+		{"v1.2.0-rc.1-3-g1a2b3c4", "v1.2.0-rc.1", false},
+		{"v1.2.0-0", "v1.2.0", true},
+		{"v1.2.0-1", "v1.2.0-1", true},
+		{"v1.2.0-3", "v1.2.0-3", true},
+		{"", "", true},
+	}
+	for _, test := range cases {
+		tag, exact := DescribeTag(test.comment)
+		assert.Equal(t, test.tag, tag, test.comment)
+		assert.Equal(t, test.exact, exact, test.comment)
+	}
+}
+
+func TestApplyVersionAtTag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ConstraintsFile)
+	body := "[[constraint]]\npattern = \"D/...\"\nversion = \"^1.2\"\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(body), 0666))
+	cons, err := ReadConstraints(path)
+	assert.Nil(t, err)
+
+	cases := []struct {
+		comment string
+		werr    bool
+	}{
+		{"v1.2.0", false},
+		{"v1.2.0-0", false},
+		{"v1.2.0-3-g1a2b3c4", true},
+		{"v1.2.0-3", true},
+		{"v1.1.0", true},
+	}
+	for _, test := range cases {
+		err := cons.apply([]pkgs.Dependency{{ImportPath: "D", Comment: test.comment}})
+		assert.Equal(t, test.werr, err != nil, test.comment)
+	}
+}
+
+func TestReadConstraintsIgnore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ConstraintsFile)
+
+	body := "[[constraint]]\npattern = \"D/...\"\nignore = true\n\n[[constraint]]\npattern = \"-D/A\"\nignore = true\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(body), 0666))
+	cons, err := ReadConstraints(path)
+	assert.Nil(t, err)
+	ignore := cons.ignores()
+	assert.True(t, ignore.Match("D/B"))
+	assert.False(t, ignore.Match("D/A"))
+
+	body = "[[constraint]]\npattern = \"D/...@\"\nignore = true\n"
+	assert.Nil(t, ioutil.WriteFile(path, []byte(body), 0666))
+	_, err = ReadConstraints(path)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,22 @@
+/*
+Package vend implements govend's vendoring of dependencies, for
+tools that would rather not run the govend command.
+
+Save copies the dependencies of the packages in the current
+directory into its vendor directory and records them in the
+manifest, vendor/Deps.json. Update moves them to newer revisions,
+Restore copies the recorded revisions back in, and Verify checks
+that the vendor directory and the manifest agree:
+
+	res, err := vend.Save(vend.SaveOptions{Packages: []string{"./cmd/..."}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, dep := range res.Added {
+		fmt.Println("vendored", dep.ImportPath, dep.Rev)
+	}
+
+Paths are relative to the current directory, and packages are
+found in GOPATH, as for the go tool.
+*/
+package vend
@@ -0,0 +1,166 @@
+package vend
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// An ImportCommentMode says what happens to the canonical import
+// path annotations of vendored Go files. These are comments of
+// the form:
+//
+//	package foo // import "bar/foo"
+//	package foo /* import "bar/foo" */
+//
+// See also http://golang.org/s/go14customimport.
+type ImportCommentMode int
+
+const (
+	StripImportComments   ImportCommentMode = iota // Remove the annotation.
+	KeepImportComments                             // Leave it alone.
+	RewriteImportComments                          // Point it at the vendored path.
+)
+
+var importCommentModes = []string{
+	StripImportComments:   "strip",
+	KeepImportComments:    "keep",
+	RewriteImportComments: "rewrite",
+}
+
+func (m ImportCommentMode) String() string {
+	if int(m) < len(importCommentModes) {
+		return importCommentModes[m]
+	}
+	return fmt.Sprintf("ImportCommentMode(%d)", int(m))
+}
+
+func (m *ImportCommentMode) Set(s string) error {
+	for i, name := range importCommentModes {
+		if s == name {
+			*m = ImportCommentMode(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown import comment mode %q, want one of %s", s, strings.Join(importCommentModes, ", "))
+}
+
+// An importCommentError is returned by copyGoFile for a file it
+// copied without applying the ImportCommentMode, because its package
+// clause couldn't be parsed.
+type importCommentError struct {
+	Name string // Base name of the file.
+	Mode ImportCommentMode
+	Err  error
+}
+
+func (e *importCommentError) Error() string {
+	return fmt.Sprintf("%s: cannot %s import comment: %v", e.Name, e.Mode, e.Err)
+}
+
+// copyGoFile copies the Go file named src from r to w, applying
+// mode to its import comment. If mode is RewriteImportComments,
+// the comment is changed to importPath. Files whose package clause
+// can't be parsed are copied unaltered, except that, as always,
+// a missing final newline is added, and an *importCommentError
+// is returned for them.
+func copyGoFile(w io.Writer, r io.Reader, src string, mode ImportCommentMode, importPath string) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var cerr error
+	if mode != KeepImportComments {
+		out, err := rewriteImportComment(b, mode, importPath)
+		if err != nil {
+			cerr = &importCommentError{Name: filepath.Base(src), Mode: mode, Err: err}
+		} else {
+			b = out
+		}
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return cerr
+}
+
+// rewriteImportComment returns the Go source src with mode applied
+// to the import comment of its package clause, if it has one.
+// Only the package clause is parsed, so the rest of the file
+// needn't be valid Go.
+func rewriteImportComment(src []byte, mode ImportCommentMode, importPath string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	c := importComment(fset, f)
+	if c == nil || mode == KeepImportComments {
+		return src, nil
+	}
+	file := fset.File(f.Package)
+	start, end := file.Offset(f.Name.End()), file.Offset(c.End())
+
+	var repl string
+	if mode == RewriteImportComments {
+		if strings.HasPrefix(c.Text, "//") {
+			repl = " // import " + strconv.Quote(importPath)
+		} else {
+			repl = " /* import " + strconv.Quote(importPath) + " */"
+		}
+	}
+	var buf bytes.Buffer
+	buf.Write(src[:start])
+	buf.WriteString(repl)
+	buf.Write(src[end:])
+	return buf.Bytes(), nil
+}
+
+// importComment returns the import comment of f's package clause,
+// or nil if it has none. Like the go tool, it only considers the
+// first comment after the package name, on the same line.
+func importComment(fset *token.FileSet, f *ast.File) *ast.Comment {
+	line := fset.Position(f.Name.End()).Line
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			if c.Pos() < f.Name.End() {
+				continue
+			}
+			if fset.Position(c.Pos()).Line != line || !isImportComment(c.Text) {
+				return nil
+			}
+			return c
+		}
+	}
+	return nil
+}
+
+// isImportComment reports whether text, the text of a comment
+// including its delimiters, is an import path annotation.
+func isImportComment(text string) bool {
+	if strings.HasPrefix(text, "//") {
+		text = text[2:]
+	} else {
+		text = strings.TrimSuffix(text[2:], "*/")
+	}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "import") {
+		return false
+	}
+	lit := strings.TrimLeft(text[len("import"):], " \t\r\n")
+	if len(lit) == len(text)-len("import") {
+		return false // no space after "import"
+	}
+	_, err := strconv.Unquote(lit)
+	return err == nil && lit[0] != '\''
+}
@@ -0,0 +1,88 @@
+package vend
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteImportComment(t *testing.T) {
+	var cases = []struct {
+		mode ImportCommentMode
+		s, w string
+		werr bool
+	}{
+		{StripImportComments, `package foo`, `package foo`, false},
+		{StripImportComments, `anything else`, ``, true},
+		{StripImportComments, `package foo // import "bar/foo"`, `package foo`, false},
+		{StripImportComments, `package foo /* import "bar/foo" */`, `package foo`, false},
+		{StripImportComments, `package  foo  //  import  "bar/foo" `, `package  foo`, false},
+		{StripImportComments, "package foo // import `bar/foo`", `package foo`, false},
+		{StripImportComments, `package foo /* import "bar/foo" */; var x int`, `package foo; var x int`, false},
+		{StripImportComments, `package foo // import "bar/foo" garbage`, `package foo // import "bar/foo" garbage`, false},
+		{StripImportComments, `package xpackage foo // import "bar/foo"`, ``, true},
+		{StripImportComments, "package foo /* import\n\t\"bar/foo\" */\n", "package foo\n", false},
+		{StripImportComments, "\ufeffpackage foo // import \"bar/foo\"\n", "\ufeffpackage foo\n", false},
+		{StripImportComments, "// +build linux\n\n/* doc */\npackage foo // import \"bar/foo\"\n\nfunc F() {}\n", "// +build linux\n\n/* doc */\npackage foo\n\nfunc F() {}\n", false},
+		{StripImportComments, "package foo\n// import \"bar/foo\"\n", "package foo\n// import \"bar/foo\"\n", false},
+		{StripImportComments, `package foo /* x */ // import "bar/foo"`, `package foo /* x */ // import "bar/foo"`, false},
+		{KeepImportComments, `package foo // import "bar/foo"`, `package foo // import "bar/foo"`, false},
+		{RewriteImportComments, `package foo // import "bar/foo"`, `package foo // import "C/vendor/bar/foo"`, false},
+		{RewriteImportComments, `package foo /* import "bar/foo" */; var x int`, `package foo /* import "C/vendor/bar/foo" */; var x int`, false},
+		{RewriteImportComments, `package foo`, `package foo`, false},
+	}
+
+	for _, test := range cases {
+		got, err := rewriteImportComment([]byte(test.s), test.mode, "C/vendor/bar/foo")
+		if test.werr {
+			assert.NotNil(t, err, test.s)
+			continue
+		}
+		assert.Nil(t, err, test.s)
+		assert.Equal(t, test.w, string(got), test.s)
+	}
+}
+
+func TestCopyGoFileUnparsed(t *testing.T) {
+	var w bytes.Buffer
+	err := copyGoFile(&w, strings.NewReader("anything else"), "/src/D/bad.go", StripImportComments, "")
+	var cerr *importCommentError
+	if assert.True(t, errors.As(err, &cerr), "%v", err) {
+		assert.Equal(t, "bad.go", cerr.Name)
+	}
+	assert.Equal(t, "anything else\n", w.String())
+}
+
+func TestCopySrcUnparsed(t *testing.T) {
+	ws, err := ioutil.TempDir("", "govend-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(ws)
+	dir := filepath.Join(ws, "src", "D")
+	makeTree(t, &node{ws, "", []*node{
+		{"src/D/main.go", "package D // import \"D\"\n", nil},
+		{"src/D/bad.go", "anything else\n", nil},
+	}}, "")
+
+	vendor := filepath.Join(ws, "src", "C", "vendor")
+	deps := []pkgs.Dependency{{ImportPath: "D", Workspace: ws, Dir: dir}}
+	unparsed, err := copySrc(vendor, "C", deps, StripImportComments)
+	assert.Nil(t, err)
+	if assert.Len(t, unparsed, 1) {
+		assert.Equal(t, "D", unparsed[0].ImportPath)
+		assert.Equal(t, pkgs.PhaseCopy, unparsed[0].Phase)
+		assert.Contains(t, unparsed[0].Error(), "bad.go: cannot strip import comment")
+	}
+	checkTree(t, &node{vendor, "", []*node{
+		{"D/main.go", "package D\n", nil},
+		{"D/bad.go", "anything else\n", nil},
+	}})
+}
@@ -0,0 +1,145 @@
+package vend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/azylman/govend/pkgs"
+)
+
+const srcdir = "vendor"
+const sep = "/" + srcdir + "/"
+
+// VendorDir is the vendor directory used when no other is given.
+const VendorDir = srcdir
+
+// manifestVersion is the schema version of the Deps.json files
+// written by this version of govend. It must be incremented, and
+// a migration added to migrations, whenever a change is made to
+// Manifest or pkgs.Dependency that older binaries must not ignore.
+const manifestVersion = 5
+
+// legacyManifests are the locations, relative to the package
+// directory, of godep manifests that govend knows how to migrate.
+var legacyManifests = []string{
+	filepath.Join("Godeps", "Godeps.json"),
+	"Godeps",
+}
+
+// migrations[v] upgrades a manifest from schema version v to v+1.
+var migrations = []func(*Manifest) error{
+	// Version 0 covers unversioned Deps.json files and godep
+	// manifests, which share the same layout.
+	0: func(g *Manifest) error { return nil },
+	// Version 2 added Dependency.Source.
+	1: func(g *Manifest) error { return nil },
+	// Version 3 added Manifest.Ignore.
+	2: func(g *Manifest) error { return nil },
+	// Version 4 added Dependency.Tag.
+	3: func(g *Manifest) error { return nil },
+	// Version 5 added Dependency.VendoredBy.
+	4: func(g *Manifest) error { return nil },
+}
+
+// Manifest describes what a package needs to be rebuilt reproducibly.
+// It's the same information stored in file Deps.
+type Manifest struct {
+	Version    int // Schema version, see manifestVersion.
+	ImportPath string
+	GoVersion  string
+	Packages   []string `json:",omitempty"` // Arguments to save, if any.
+	Ignore     []string `json:",omitempty"` // Patterns of packages never to vendor.
+	Deps       []pkgs.Dependency
+}
+
+// ReadManifest reads the manifest at path into g, upgrading it to
+// the current schema version. It refuses manifests written with a
+// newer schema, since saving them would drop fields we don't know.
+func ReadManifest(path string, g *Manifest) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(g); err != nil {
+		return err
+	}
+	if g.Version > manifestVersion {
+		return fmt.Errorf("%s: schema version %d is newer than %d, please upgrade govend", path, g.Version, manifestVersion)
+	}
+	if _, err := pkgs.ParsePatterns(g.Ignore); err != nil {
+		return fmt.Errorf("%s: ignore list: %v", path, err)
+	}
+	return g.migrate()
+}
+
+// readLegacyManifest reads the first godep manifest found in
+// the current directory into g.
+// If there is none, it returns an error satisfying os.IsNotExist.
+func readLegacyManifest(g *Manifest) error {
+	for _, path := range legacyManifests {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		log.Println("migrating legacy manifest:", path)
+		return ReadManifest(path, g)
+	}
+	return &os.PathError{Op: "open", Path: filepath.Join(srcdir, "Deps.json"), Err: os.ErrNotExist}
+}
+
+// readDepManifest reads into g the manifest the dependency in dir
+// was itself vendored with: a govend manifest in its vendor
+// directory or, failing that, a godep manifest. If there is none,
+// it returns an error satisfying os.IsNotExist.
+func readDepManifest(dir string, g *Manifest) error {
+	err := ReadManifest(filepath.Join(dir, srcdir, "Deps.json"), g)
+	for _, legacy := range legacyManifests {
+		if !os.IsNotExist(err) {
+			break
+		}
+		path := filepath.Join(dir, legacy)
+		if fi, serr := os.Stat(path); serr == nil && fi.IsDir() {
+			continue
+		}
+		err = ReadManifest(path, g)
+	}
+	return err
+}
+
+func (g *Manifest) migrate() error {
+	for g.Version < manifestVersion {
+		if err := migrations[g.Version](g); err != nil {
+			return fmt.Errorf("migrating manifest from version %d: %v", g.Version, err)
+		}
+		g.Version++
+	}
+	return nil
+}
+
+type Deps []pkgs.Dependency
+
+func (d Deps) Len() int           { return len(d) }
+func (d Deps) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d Deps) Less(i, j int) bool { return d[i].ImportPath < d[j].ImportPath }
+
+func (g *Manifest) sortDeps() {
+	sort.Sort(Deps(g.Deps))
+}
+
+func (g *Manifest) WriteTo(w io.Writer) (int64, error) {
+	// Make sure we're writing in a consistent order
+	g.sortDeps()
+	g.Version = manifestVersion
+
+	b, err := json.MarshalIndent(g, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
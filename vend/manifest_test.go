@@ -0,0 +1,92 @@
+package vend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadManifest(t *testing.T) {
+	var cases = []struct {
+		desc string
+		body string
+		want Manifest
+		werr bool
+	}{
+		{
+			desc: "current version",
+			body: `{"Version": 2, "ImportPath": "C", "Deps": [{"ImportPath": "D", "Rev": "abc", "Source": "E"}]}`,
+			want: Manifest{
+				Version:    manifestVersion,
+				ImportPath: "C",
+				Deps:       []pkgs.Dependency{{ImportPath: "D", Rev: "abc", Source: "E"}},
+			},
+		},
+		{
+			desc: "unversioned manifest is migrated",
+			body: `{"ImportPath": "C", "GoVersion": "go1.5", "Deps": [{"ImportPath": "D", "Rev": "abc"}]}`,
+			want: Manifest{
+				Version:    manifestVersion,
+				ImportPath: "C",
+				GoVersion:  "go1.5",
+				Deps:       []pkgs.Dependency{{ImportPath: "D", Rev: "abc"}},
+			},
+		},
+		{
+			desc: "newer version is refused",
+			body: `{"Version": 1000, "ImportPath": "C"}`,
+			werr: true,
+		},
+		{
+			desc: "malformed ignore pattern is refused",
+			body: `{"Version": 2, "ImportPath": "C", "Ignore": ["D/...@"]}`,
+			werr: true,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Deps.json")
+	for _, test := range cases {
+		t.Logf("desc: %s", test.desc)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(test.body), 0666))
+		var g Manifest
+		err := ReadManifest(path, &g)
+		if test.werr {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, g)
+	}
+}
+
+func TestReadCurManifestLegacy(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	g, err := CurrentManifest(srcdir)
+	assert.Nil(t, err)
+	assert.Equal(t, manifestVersion, g.Version)
+	assert.Equal(t, 0, len(g.Deps))
+
+	body := `{"ImportPath": "C", "GodepVersion": "v74", "Deps": [{"ImportPath": "D", "Comment": "v1.0", "Rev": "abc"}]}`
+	assert.Nil(t, writeFile(filepath.Join("Godeps", "Godeps.json"), body))
+	g, err = CurrentManifest(srcdir)
+	assert.Nil(t, err)
+	assert.Equal(t, Manifest{
+		Version:    manifestVersion,
+		ImportPath: "C",
+		Deps:       []pkgs.Dependency{{ImportPath: "D", Comment: "v1.0", Rev: "abc"}},
+	}, g)
+}
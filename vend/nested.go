@@ -0,0 +1,315 @@
+package vend
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azylman/govend/pkgs"
+)
+
+// A nestedVendor is a vendor directory inside a vendored dependency.
+type nestedVendor struct {
+	Parent string                     // Import path of the dependency holding it.
+	Dir    string                     // The vendor directory.
+	Pkgs   []string                   // Import paths of the packages in it, sorted.
+	Pins   map[string]pkgs.Dependency // What the parent's manifest pinned, by import path.
+}
+
+// findNested returns the vendor directories nested in the
+// vendor directory root, sorted by parent import path.
+func findNested(root string) ([]nestedVendor, error) {
+	var nested []nestedVendor
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+	err := filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() || name == root || fi.Name() != srcdir {
+			return err
+		}
+		parent, err := filepath.Rel(root, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		nv := nestedVendor{Parent: filepath.ToSlash(parent), Dir: name}
+		if nv.Pkgs, err = listPkgDirs(name); err != nil {
+			return err
+		}
+		nv.Pins = nestedPins(root, nv)
+		nested = append(nested, nv)
+		return nil
+	})
+	return nested, err
+}
+
+// listPkgDirs returns the import paths, relative to the vendor
+// directory dir, of the directories in it holding .go files.
+// Vendor directories nested further down are not included.
+func listPkgDirs(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() && name != dir && fi.Name() == srcdir {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() || !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		if p := filepath.ToSlash(rel); len(paths) == 0 || paths[len(paths)-1] != p {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return uniqStrings(paths), err
+}
+
+// nestedPins returns the dependencies pinned by the manifest of the
+// dependency holding nv, either a govend manifest in the nested
+// vendor directory or a godep manifest in the dependency itself.
+func nestedPins(root string, nv nestedVendor) map[string]pkgs.Dependency {
+	var g Manifest
+	if err := readDepManifest(filepath.Join(root, filepath.FromSlash(nv.Parent)), &g); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("reading manifest of %s: %v", nv.Parent, err)
+		}
+		return nil
+	}
+	pins := make(map[string]pkgs.Dependency)
+	for _, p := range nv.Pkgs {
+		if dep, ok := findDep(g.Deps, p); ok {
+			pins[p] = dep
+		}
+	}
+	return pins
+}
+
+// findDep returns the dependency in deps for importPath, which is
+// either the dependency itself or one from the same directory tree.
+func findDep(deps []pkgs.Dependency, importPath string) (pkgs.Dependency, bool) {
+	for p := importPath; p != "." && p != "/"; p = path.Dir(p) {
+		for _, dep := range deps {
+			if dep.ImportPath == p {
+				return dep, true
+			}
+		}
+	}
+	return pkgs.Dependency{}, false
+}
+
+// checkNested reports the vendor directories nested in the vendor
+// directory root and how their packages disagree with deps.
+// A nested copy of importPath itself, the project being vendored,
+// is reported as a cycle. If strip is set, nested copies of
+// packages in deps are deleted.
+func checkNested(root, importPath string, deps []pkgs.Dependency, strip bool) error {
+	nested, err := findNested(root)
+	if err != nil {
+		return err
+	}
+	for _, nv := range nested {
+		for _, p := range nv.Pkgs {
+			pin, pinned := nv.Pins[p]
+			dep, ok := findDep(deps, p)
+			switch {
+			case p == importPath || strings.HasPrefix(p, importPath+"/"):
+				log.Printf("import cycle: %s vendors %s", nv.Parent, p)
+				continue
+			case !ok:
+				log.Printf("%s vendors %s, which is not in the manifest", nv.Parent, p)
+				continue
+			case !pinned:
+				log.Printf("%s vendors its own copy of %s", nv.Parent, p)
+			case pin.Rev != dep.Rev:
+				log.Printf("%s vendors %s at %s, but the manifest has %s", nv.Parent, p, pin.Rev, dep.Rev)
+			}
+			if strip {
+				if err := os.RemoveAll(filepath.Join(nv.Dir, filepath.FromSlash(p))); err != nil {
+					return err
+				}
+			}
+		}
+		if strip {
+			if err := removeIfEmpty(nv.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeIfEmpty removes dir and its subdirectories if none of them
+// hold files other than manifests, which are useless on their own.
+func removeIfEmpty(dir string) error {
+	empty := true
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && fi.Name() != "Deps.json" && fi.Name() != "README" {
+			empty = false
+		}
+		return nil
+	})
+	if err != nil || !empty {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func uniqStrings(a []string) []string {
+	var b []string
+	for i, s := range a {
+		if i == 0 || s != a[i-1] {
+			b = append(b, s)
+		}
+	}
+	return b
+}
+
+// flattenNested hoists the packages in vendor directories nested in
+// the vendor directory root up into root, and removes the nested
+// directories. Packages not already in m are added to it, pinned at
+// the revision their parent's manifest gives, if any. Nested copies
+// of packages m already has from their own repo are deleted.
+func flattenNested(root string, m *Manifest) error {
+	nested, err := findNested(root)
+	if err != nil {
+		return err
+	}
+	// Deeper vendor directories sort after the ones holding them,
+	// so working backwards hoists their packages before they go.
+	for i := len(nested) - 1; i >= 0; i-- {
+		nv := nested[i]
+		parent := pkgs.Unqualify(nv.Parent)
+		for _, p := range nv.Pkgs {
+			if p == m.ImportPath || strings.HasPrefix(p, m.ImportPath+"/") {
+				continue
+			}
+			if dep, ok := findDep(m.Deps, p); ok && dep.VendoredBy == "" {
+				continue
+			}
+			j := depIndex(m.Deps, p)
+			pin := nv.Pins[p]
+			dep := pkgs.Dependency{ImportPath: p, Comment: pin.Comment, Rev: pin.Rev, VendoredBy: parent}
+			if j >= 0 {
+				m.Deps[j] = dep
+			} else {
+				m.Deps = append(m.Deps, dep)
+			}
+			if dep.Rev == "" {
+				log.Printf("hoisting %s from %s at an unknown revision", p, parent)
+			}
+			src := filepath.Join(nv.Dir, filepath.FromSlash(p))
+			if err := movePkgFiles(filepath.Join(root, filepath.FromSlash(p)), src); err != nil {
+				return err
+			}
+		}
+		if err := os.RemoveAll(nv.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// depIndex returns the index of the dependency on importPath
+// in deps, or -1 if there is none.
+func depIndex(deps []pkgs.Dependency, importPath string) int {
+	for i, dep := range deps {
+		if dep.ImportPath == importPath {
+			return i
+		}
+	}
+	return -1
+}
+
+// movePkgFiles replaces the files of the package in dst with those
+// of the package in src. Subdirectories of either are left alone.
+func movePkgFiles(dst, src string) error {
+	if err := removePkgFiles(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		if err := os.Rename(filepath.Join(src, fi.Name()), filepath.Join(dst, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removePkgFiles(dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hoisted reports whether any of deps was hoisted out of
+// another dependency's vendor directory.
+func hoisted(deps []pkgs.Dependency) bool {
+	for _, dep := range deps {
+		if dep.VendoredBy != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnDeps returns the dependencies in deps that were copied from
+// their own repo rather than hoisted from another dependency.
+func OwnDeps(deps []pkgs.Dependency) []pkgs.Dependency {
+	own := []pkgs.Dependency{}
+	for _, dep := range deps {
+		if dep.VendoredBy == "" {
+			own = append(own, dep)
+		}
+	}
+	return own
+}
+
+// keepHoisted returns the dependencies in rem, less those hoisted
+// from a dependency in deps, which are still needed.
+func keepHoisted(rem, deps []pkgs.Dependency) []pkgs.Dependency {
+	kept := []pkgs.Dependency{}
+	for _, dep := range rem {
+		if dep.VendoredBy != "" {
+			if _, ok := findDep(deps, dep.VendoredBy); ok {
+				continue
+			}
+		}
+		kept = append(kept, dep)
+	}
+	return kept
+}
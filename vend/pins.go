@@ -0,0 +1,167 @@
+package vend
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azylman/govend/pkgs"
+)
+
+// A pin is the revision a dependency's own manifest gives
+// for one of its dependencies.
+type pin struct {
+	By  string          // Repo root of the dependency whose manifest it is.
+	Dep pkgs.Dependency // As recorded there.
+}
+
+// readPins returns the pins in the manifests of the repos of deps,
+// as listed by ListDeps, by the import path of the pinned package.
+// The manifest of a repo already in manifest is read from its copy
+// in the vendor directory dir, at the revision we vendored; that of
+// a new one from GOPATH.
+func readPins(dir string, manifest []pkgs.Dependency, deps []pkgs.Dependency) map[string][]pin {
+	pins := make(map[string][]pin)
+	seen := make(map[string]bool) // repo roots
+	for _, dep := range deps {
+		if dep.Root == "" || seen[dep.Root] {
+			continue
+		}
+		seen[dep.Root] = true
+		repoDir := filepath.Join(dep.Workspace, "src", filepath.FromSlash(dep.Root))
+		if _, ok := findDep(manifest, dep.ImportPath); ok {
+			repoDir = filepath.Join(dir, filepath.FromSlash(dep.Root))
+		}
+		var g Manifest
+		if err := readDepManifest(repoDir, &g); err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("reading manifest of %s: %v", dep.Root, err)
+			}
+			continue
+		}
+		for _, d := range g.Deps {
+			if d.Rev == "" {
+				continue
+			}
+			pins[d.ImportPath] = append(pins[d.ImportPath], pin{By: dep.Root, Dep: d})
+		}
+	}
+	return pins
+}
+
+// pinFor returns the pin for importPath, or for the package
+// containing it, if the manifests that pin it agree. Disagreements
+// are reported.
+func pinFor(pins map[string][]pin, importPath string) (pin, bool) {
+	var ps []pin
+	for p := importPath; p != "." && p != "/" && len(ps) == 0; p = path.Dir(p) {
+		ps = pins[p]
+	}
+	if len(ps) == 0 {
+		return pin{}, false
+	}
+	for _, p := range ps[1:] {
+		if p.Dep.Rev != ps[0].Dep.Rev {
+			var by []string
+			for _, p := range ps {
+				by = append(by, p.By+" pins "+p.Dep.Rev)
+			}
+			sort.Strings(by)
+			log.Printf("%s: dependencies disagree, not using their pins: %v", importPath, by)
+			return pin{}, false
+		}
+	}
+	return ps[0], true
+}
+
+// preferPins moves the dependencies in add, new to the manifest, to
+// the revision the other dependencies' own manifests pin them at, if
+// they agree. A repo's packages share one revision, so they move
+// together, by repo root, and only if the pins of all of them agree
+// and the constraints govern the version of none. If checkout is
+// set, the pinned revisions are checked out in GOPATH; otherwise the
+// caller copies them from elsewhere, such as a cache. Repos already
+// in the manifest are left alone, but pins they disagree with are
+// reported.
+func preferPins(dir string, manifest, deps, add []pkgs.Dependency, cons *Constraints, checkout bool) error {
+	pins := readPins(dir, manifest, deps)
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, dep := range manifest {
+		if p, ok := pinFor(pins, dep.ImportPath); ok && p.Dep.Rev != dep.Rev {
+			log.Printf("%s is at %s, but %s pins %s", dep.ImportPath, dep.Rev, p.By, p.Dep.Rev)
+		}
+	}
+	var roots []string
+	byRoot := make(map[string][]int) // repo root → indexes in add
+	for i, dep := range add {
+		if _, ok := byRoot[dep.Root]; !ok {
+			roots = append(roots, dep.Root)
+		}
+		byRoot[dep.Root] = append(byRoot[dep.Root], i)
+	}
+	var moved []pkgs.Dependency
+	var idx []int
+	for _, root := range roots {
+		if inRepo(manifest, root) {
+			continue
+		}
+		p, ok := repoPin(pins, add, byRoot[root], cons)
+		if !ok || p.Dep.Rev == add[byRoot[root][0]].Rev {
+			continue
+		}
+		for _, i := range byRoot[root] {
+			dep := add[i]
+			log.Printf("%s: using %s, pinned by %s, instead of %s", dep.ImportPath, p.Dep.Rev, p.By, dep.Rev)
+			dep.Rev, dep.Comment, dep.Tag = p.Dep.Rev, p.Dep.Comment, ""
+			moved = append(moved, dep)
+			idx = append(idx, i)
+		}
+	}
+	if checkout {
+		if err := pkgs.CheckoutRevs(moved); err != nil {
+			return err
+		}
+	}
+	for j, i := range idx {
+		add[i] = moved[j]
+	}
+	return nil
+}
+
+// repoPin returns the pin for the packages add[i], for i in idx, all
+// from one repo, if they have pins that agree and the constraints
+// govern the version of none. Disagreements are reported.
+func repoPin(pins map[string][]pin, add []pkgs.Dependency, idx []int, cons *Constraints) (pin, bool) {
+	var found pin
+	for _, i := range idx {
+		dep := add[i]
+		if con := cons.match(dep.ImportPath); con != nil && con.version != nil {
+			return pin{}, false
+		}
+		p, ok := pinFor(pins, dep.ImportPath)
+		if !ok {
+			continue
+		}
+		if found.By != "" && p.Dep.Rev != found.Dep.Rev {
+			log.Printf("%s: %s pins %s, but %s pins %s, not using either", dep.Root, found.By, found.Dep.Rev, p.By, p.Dep.Rev)
+			return pin{}, false
+		}
+		found = p
+	}
+	return found, found.By != ""
+}
+
+// inRepo reports whether any of deps is from the repo root.
+func inRepo(deps []pkgs.Dependency, root string) bool {
+	for _, dep := range deps {
+		if dep.ImportPath == root || strings.HasPrefix(dep.ImportPath, root+"/") {
+			return true
+		}
+	}
+	return false
+}
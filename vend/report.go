@@ -0,0 +1,204 @@
+package vend
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/azylman/govend/pkgs"
+)
+
+// A Report lists the dependencies a Save or Update changed.
+// The lists are never nil, so they encode as [] in JSON.
+type Report struct {
+	Added   []Change
+	Removed []Change
+	Updated []Change
+}
+
+// A Change is a dependency added, removed or moved to a new revision.
+type Change struct {
+	ImportPath   string
+	Root         string `json:",omitempty"` // Import path of the repo root, if known.
+	OldRev       string `json:",omitempty"`
+	NewRev       string `json:",omitempty"`
+	OldComment   string `json:",omitempty"`
+	NewComment   string `json:",omitempty"`
+	FilesChanged int    // Files of the package added, deleted or modified in the vendor directory.
+}
+
+// Merge appends the changes in o to r.
+func (r *Report) Merge(o Report) {
+	r.Added = append(r.Added, o.Added...)
+	r.Removed = append(r.Removed, o.Removed...)
+	r.Updated = append(r.Updated, o.Updated...)
+}
+
+// diffDeps reports the dependencies added to, removed from and moved
+// to another revision in, new compared to old. FilesChanged is left
+// for countFiles to fill in.
+func diffDeps(old, new []pkgs.Dependency) Report {
+	r := Report{Added: []Change{}, Removed: []Change{}, Updated: []Change{}}
+	for _, nd := range new {
+		i := depIndex(old, nd.ImportPath)
+		c := Change{
+			ImportPath: nd.ImportPath,
+			Root:       nd.Root,
+			NewRev:     nd.Rev,
+			NewComment: nd.Comment,
+		}
+		switch {
+		case i < 0:
+			r.Added = append(r.Added, c)
+		case old[i].Rev != nd.Rev:
+			c.OldRev, c.OldComment = old[i].Rev, old[i].Comment
+			r.Updated = append(r.Updated, c)
+		}
+	}
+	for _, od := range old {
+		if depIndex(new, od.ImportPath) < 0 {
+			r.Removed = append(r.Removed, Change{
+				ImportPath: od.ImportPath,
+				Root:       od.Root,
+				OldRev:     od.Rev,
+				OldComment: od.Comment,
+			})
+		}
+	}
+	for _, cs := range [][]Change{r.Added, r.Removed, r.Updated} {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].ImportPath < cs[j].ImportPath })
+	}
+	return r
+}
+
+// paths returns the sorted import paths of the changed dependencies.
+func (r *Report) paths() []string {
+	var paths []string
+	for _, cs := range [][]Change{r.Added, r.Removed, r.Updated} {
+		for _, c := range cs {
+			paths = append(paths, c.ImportPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// countFiles sets the FilesChanged of each change in r by comparing
+// before, a snapshot of the vendor directory dir taken before it was
+// changed, with the directory now. The other arguments are as for
+// snapshot.
+func (r *Report) countFiles(dir string, before map[string]fileSums, pkgPaths []string) error {
+	after, err := snapshot(dir, r.paths(), pkgPaths)
+	if err != nil {
+		return err
+	}
+	for _, cs := range [][]Change{r.Added, r.Removed, r.Updated} {
+		for i := range cs {
+			p := cs[i].ImportPath
+			cs[i].FilesChanged = countChanged(before[p], after[p])
+		}
+	}
+	return nil
+}
+
+// fileSums maps the names of a package's files, relative to the
+// vendor directory, to a checksum of their contents.
+type fileSums map[string]string
+
+// snapshot returns the checksums of the files of each of the
+// packages named by paths in the vendor directory dir. As copySrc
+// copies them, the files of a package include those in its
+// subdirectories, except ones holding other packages in pkgPaths.
+func snapshot(dir string, paths, pkgPaths []string) (map[string]fileSums, error) {
+	isPkg := make(map[string]bool)
+	for _, p := range pkgPaths {
+		isPkg[p] = true
+	}
+	snap := make(map[string]fileSums)
+	for _, p := range paths {
+		root := filepath.Join(dir, filepath.FromSlash(p))
+		sums := make(fileSums)
+		err := filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && name == root {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if fi.IsDir() {
+				if name != root && isPkg[rel] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			sum, err := fileSum(name, fi)
+			if err != nil {
+				return err
+			}
+			sums[rel] = sum
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		snap[p] = sums
+	}
+	return snap, nil
+}
+
+// fileSum returns a checksum of the contents of the file name,
+// or of the target of the symlink.
+func fileSum(name string, fi os.FileInfo) (string, error) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(name)
+		return "-> " + target, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// countChanged returns the number of files added, deleted
+// or modified between a and b.
+func countChanged(a, b fileSums) int {
+	n := 0
+	for name, sum := range a {
+		if b[name] != sum {
+			n++
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// depPaths returns the sorted import paths of the dependencies in
+// each of deps.
+func depPaths(deps ...[]pkgs.Dependency) []string {
+	var paths []string
+	for _, ds := range deps {
+		for _, dep := range ds {
+			paths = append(paths, dep.ImportPath)
+		}
+	}
+	sort.Strings(paths)
+	return uniqStrings(paths)
+}
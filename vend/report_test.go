@@ -0,0 +1,66 @@
+package vend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, body string) {
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("D/main.go", "package D\n")
+	write("D/doc.go", "package D\n")
+	write("D/A/main.go", "package A\n")
+	write("E/main.go", "package E\n")
+
+	old := []pkgs.Dependency{
+		{ImportPath: "D", Rev: "1", Comment: "D1"},
+		{ImportPath: "D/A", Rev: "1", Comment: "D1"},
+		{ImportPath: "E", Rev: "2"},
+	}
+	new := []pkgs.Dependency{
+		{ImportPath: "D", Rev: "3", Comment: "D3", Root: "D"},
+		{ImportPath: "D/A", Rev: "3", Comment: "D3", Root: "D"},
+		{ImportPath: "F", Rev: "4", Root: "F"},
+	}
+	pkgPaths := depPaths(old, new)
+	before, err := snapshot(dir, pkgPaths, pkgPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("D/main.go", "package D\n\nvar X int\n")
+	os.Remove(filepath.Join(dir, "D", "doc.go"))
+	write("D/new.go", "package D\n")
+	os.RemoveAll(filepath.Join(dir, "E"))
+	write("F/main.go", "package F\n")
+
+	r := diffDeps(old, new)
+	if err := r.countFiles(dir, before, pkgPaths); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Report{
+		Added: []Change{
+			{ImportPath: "F", Root: "F", NewRev: "4", FilesChanged: 1},
+		},
+		Removed: []Change{
+			{ImportPath: "E", OldRev: "2", FilesChanged: 1},
+		},
+		Updated: []Change{
+			{ImportPath: "D", Root: "D", OldRev: "1", NewRev: "3", OldComment: "D1", NewComment: "D3", FilesChanged: 3},
+			{ImportPath: "D/A", Root: "D", OldRev: "1", NewRev: "3", OldComment: "D1", NewComment: "D3", FilesChanged: 0},
+		},
+	}, r)
+}
@@ -0,0 +1,120 @@
+package vend
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/vcs"
+)
+
+// RestoreOptions controls how Restore copies dependencies.
+type RestoreOptions struct {
+	// Bundle is the path of a vendor bundle to restore from,
+	// without using the network. If empty, Cache is used.
+	Bundle string
+
+	// Cache holds checkouts of the recorded revisions,
+	// fetching them if need be.
+	Cache *cache.Cache
+
+	ImportComments ImportCommentMode // As for Save.
+	Rewrite        bool              // As for Save, but only in the vendor directory.
+	Vendor         string            // As for Save.
+}
+
+// RestoreResult describes what Restore did.
+type RestoreResult struct {
+	Manifest Manifest
+	Restored []pkgs.Dependency // Copied from their own repo; hoisted ones are not listed.
+	Unparsed pkgs.Errors       // Go files copied without ImportComments applied; see SaveResult.
+}
+
+// Restore copies each dependency in the manifest into the vendor
+// directory from a bundle or a cache checkout of its recorded
+// revision.
+func Restore(opts RestoreOptions) (*RestoreResult, error) {
+	manifest, err := CurrentManifest(vendorDir(opts.Vendor))
+	if err != nil {
+		return nil, err
+	}
+	deps := OwnDeps(manifest.Deps)
+	switch {
+	case opts.Bundle != "":
+		a, err := vcs.OpenArchive(opts.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		defer a.Close()
+		tmp, err := ioutil.TempDir("", "govend-restore")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		if err := exportDeps(a, tmp, deps); err != nil {
+			return nil, err
+		}
+	case opts.Cache != nil:
+		if err := opts.Cache.CheckoutDeps(deps); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no bundle or cache to restore from")
+	}
+	unparsed, err := copyRestored(manifest, deps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &RestoreResult{Manifest: manifest, Restored: deps, Unparsed: unparsed}, nil
+}
+
+// copyRestored copies deps into the vendor directory and hoists
+// the packages the manifest records as vendored by them back out
+// of their nested vendor directories. It returns the Go files
+// copied without ImportComments applied, as copySrc does.
+func copyRestored(manifest Manifest, deps []pkgs.Dependency, opts RestoreOptions) (pkgs.Errors, error) {
+	vendor := vendorDir(opts.Vendor)
+	parent := vendorParent(manifest.ImportPath, vendor)
+	unparsed, err := copySrc(vendor, parent, deps, opts.ImportComments)
+	if err != nil {
+		return nil, err
+	}
+	if hoisted(manifest.Deps) {
+		if err := flattenNested(vendor, &manifest); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Rewrite {
+		if err := rewriteTree(vendor, parent+"/"+srcdir, qualifier(parent, manifest.Deps)); err != nil {
+			return nil, err
+		}
+	}
+	return unparsed, nil
+}
+
+// exportDeps exports the repo of each of deps from a into a workspace
+// under dir, and points the dependency's Workspace and Dir there.
+func exportDeps(a *vcs.Archive, dir string, deps []pkgs.Dependency) error {
+	for i := range deps {
+		dep := &deps[i]
+		root, ok := a.Lookup(dep.ImportPath, dep.Rev)
+		if !ok {
+			return fmt.Errorf("%s: bundle has no revision %s", dep.ImportPath, dep.Rev)
+		}
+		ws := filepath.Join(dir, dep.Rev)
+		if _, err := os.Stat(cache.PackageDir(ws, root)); os.IsNotExist(err) {
+			rr := a.RepoRoot(root)
+			if err := rr.VCS.Export(rr.Repo, dep.Rev, cache.PackageDir(ws, root)); err != nil {
+				return err
+			}
+		}
+		dep.Workspace = ws
+		dep.Dir = cache.PackageDir(ws, dep.ImportPath)
+		dep.Root = root
+	}
+	return nil
+}
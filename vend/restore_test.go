@@ -0,0 +1,54 @@
+package vend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreFromBundle(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	a := &vcs.Archive{Dir: filepath.Join(tmp, "bundle")}
+	src := filepath.Join(tmp, "D")
+	assert.Nil(t, writeFile(filepath.Join(src, "main.go"), `package D // import "D"`+"\n"))
+	assert.Nil(t, writeFile(filepath.Join(src, "A", "a.go"), pkg("A")))
+	assert.Nil(t, a.Add("D", "d1", src))
+	assert.Nil(t, writeFile(filepath.Join(src, "main.go"), pkg("D")+decl("D2")))
+	assert.Nil(t, a.Add("D", "d2", src))
+	tarball := filepath.Join(tmp, "bundle.tar.gz")
+	assert.Nil(t, a.Save(tarball))
+
+	for _, path := range []string{a.Dir, tarball} {
+		t.Logf("bundle: %s", path)
+		dir := filepath.Join(tmp, "C")
+		assert.Nil(t, os.RemoveAll(dir))
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, srcdir), 0777))
+		f, err := os.Create(filepath.Join(dir, srcdir, "Deps.json"))
+		assert.Nil(t, err)
+		g := deps("C", "D", "", "D/A", "")
+		g.Deps[0].Rev = "d1"
+		g.Deps[1].Rev = "d1"
+		_, err = g.WriteTo(f)
+		assert.Nil(t, err)
+		f.Close()
+
+		assert.Nil(t, os.Chdir(dir))
+		_, err = Restore(RestoreOptions{Bundle: path})
+		assert.Nil(t, os.Chdir(wd))
+		assert.Nil(t, err)
+
+		checkTree(t, &node{dir, "", []*node{
+			{"vendor/D/main.go", "package D\n", nil},
+			{"vendor/D/A/a.go", pkg("A"), nil},
+		}})
+	}
+}
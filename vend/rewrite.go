@@ -0,0 +1,146 @@
+package vend
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/azylman/govend/pkgs"
+)
+
+// Unrewrite undoes SaveOptions.Rewrite, changing the fully-qualified
+// imports of packages in the vendor directory, or vendor/ if it is
+// empty, back to their original path, in the whole tree it serves.
+func Unrewrite(vendor string) error {
+	vendor = vendorDir(vendor)
+	manifest, err := CurrentManifest(vendor)
+	if err != nil {
+		return err
+	}
+	parent := vendorParent(manifest.ImportPath, vendor)
+	return rewriteTree(filepath.Dir(vendor), parent, unqualifier(parent))
+}
+
+// qualifier returns a function that rewrites imports of the
+// packages in deps to their fully-qualified path in the vendor
+// directory of importPath, e.g. D to C/vendor/D.
+func qualifier(importPath string, deps []pkgs.Dependency) func(string) string {
+	return func(p string) string {
+		p = pkgs.Unqualify(p)
+		if _, ok := findDep(deps, p); !ok {
+			return ""
+		}
+		return importPath + sep + p
+	}
+}
+
+// unqualifier returns a function that rewrites fully-qualified
+// imports of packages in the vendor directory of importPath back
+// to their original path, e.g. C/vendor/D to D.
+func unqualifier(importPath string) func(string) string {
+	return func(p string) string {
+		if !strings.HasPrefix(p, importPath+sep) {
+			return ""
+		}
+		return pkgs.Unqualify(p)
+	}
+}
+
+// rewriteTree rewrites the imports of the Go files in the tree
+// rooted at dir, whose import path is importPath, vendored files
+// included. For each import path, rewrite returns the new path, or
+// "" to leave it alone. Files that can't be rewritten are skipped
+// and returned as pkgs.Errors, by package.
+func rewriteTree(dir, importPath string, rewrite func(string) string) error {
+	var errs pkgs.Errors
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if c := fi.Name()[0]; name != dir && (c == '.' || c == '_' || fi.Name() == "testdata") {
+			// Skip directories using a rule similar to how
+			// the go tool enumerates packages.
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || !strings.HasSuffix(name, ".go") || fi.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if err := rewriteFile(name, rewrite); err != nil {
+			pkgDir := filepath.Dir(name)
+			rel, rerr := filepath.Rel(dir, pkgDir)
+			if rerr != nil { // this should never happen
+				return rerr
+			}
+			errs.Add(path.Join(importPath, filepath.ToSlash(rel)), pkgDir, pkgs.PhaseRewrite, fmt.Errorf("%s: %v", fi.Name(), err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errs.Err()
+}
+
+// rewriteFile rewrites the imports of the Go file name,
+// leaving it untouched if none of them change.
+func rewriteFile(name string, rewrite func(string) string) error {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	out, err := rewriteImports(src, rewrite)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, out) {
+		return nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, out, fi.Mode())
+}
+
+// rewriteImports returns the Go source src with the path of each
+// import changed as rewrite says. Only the import paths themselves
+// are replaced, so formatting and comments are preserved.
+func rewriteImports(src []byte, rewrite func(string) string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	file := fset.File(f.Package)
+	var buf bytes.Buffer
+	last := 0
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		np := rewrite(p)
+		if np == "" || np == p {
+			continue
+		}
+		start, end := file.Offset(spec.Path.Pos()), file.Offset(spec.Path.End())
+		buf.Write(src[last:start])
+		buf.WriteString(strconv.Quote(np))
+		last = end
+	}
+	if last == 0 {
+		return src, nil
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
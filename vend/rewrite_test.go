@@ -0,0 +1,92 @@
+package vend
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteImports(t *testing.T) {
+	deps := []pkgs.Dependency{{ImportPath: "D"}, {ImportPath: "E/A"}}
+	var cases = []struct {
+		desc string
+		src  string
+		want string
+		back string // want, unrewritten, if not src
+	}{
+		{
+			desc: "single import",
+			src:  "package main\n\nimport \"D\"\n",
+			want: "package main\n\nimport \"C/vendor/D\"\n",
+		},
+		{
+			desc: "grouped imports keep comments and names",
+			src: "package main\n\nimport (\n\t\"fmt\" // std\n\n\t" +
+				"d \"D/sub\" /* dep */\n\t_ \"E/A\"\n\t\"E/B\"\n\t\"C/vendor/D\"\n)\n\nfunc main() {}\n",
+			want: "package main\n\nimport (\n\t\"fmt\" // std\n\n\t" +
+				"d \"C/vendor/D/sub\" /* dep */\n\t_ \"C/vendor/E/A\"\n\t\"E/B\"\n\t\"C/vendor/D\"\n)\n\nfunc main() {}\n",
+			back: "package main\n\nimport (\n\t\"fmt\" // std\n\n\t" +
+				"d \"D/sub\" /* dep */\n\t_ \"E/A\"\n\t\"E/B\"\n\t\"D\"\n)\n\nfunc main() {}\n",
+		},
+		{
+			desc: "no imports",
+			src:  "package main\n",
+			want: "package main\n",
+		},
+	}
+
+	for _, test := range cases {
+		got, err := rewriteImports([]byte(test.src), qualifier("C", deps))
+		assert.Nil(t, err, test.desc)
+		assert.Equal(t, test.want, string(got), test.desc)
+
+		orig, err := rewriteImports(got, unqualifier("C"))
+		assert.Nil(t, err, test.desc)
+		back := test.back
+		if back == "" {
+			back = test.src
+		}
+		assert.Equal(t, back, string(orig), test.desc)
+	}
+
+	_, err := rewriteImports([]byte("package main\nimport D\n"), qualifier("C", deps))
+	assert.NotNil(t, err)
+}
+
+func TestRewriteTreeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for name, body := range map[string]string{
+		"main.go":            "package main\n\nimport \"D\"\n",
+		"vendor/D/d.go":      "package D\n",
+		"vendor/D/broken.go": "package D\n\nimport (\n",
+		"cmd/x/broken.go":    "not go",
+	} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(name), 0777))
+		assert.Nil(t, ioutil.WriteFile(name, []byte(body), 0666))
+	}
+
+	err = rewriteTree(dir, "C", qualifier("C", []pkgs.Dependency{{ImportPath: "D"}}))
+	var errs pkgs.Errors
+	if !assert.True(t, errors.As(err, &errs)) {
+		return
+	}
+	var got []string
+	for _, perr := range errs {
+		assert.Equal(t, pkgs.PhaseRewrite, perr.Phase)
+		got = append(got, perr.ImportPath)
+	}
+	assert.Equal(t, []string{"C/cmd/x", "C/vendor/D"}, got)
+
+	// The other files are rewritten all the same.
+	body, err := ioutil.ReadFile(filepath.Join(dir, "main.go"))
+	assert.Nil(t, err)
+	assert.Equal(t, "package main\n\nimport \"C/vendor/D\"\n", string(body))
+}
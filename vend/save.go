@@ -0,0 +1,499 @@
+package vend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/pkgs"
+	"github.com/kr/fs"
+)
+
+// SaveOptions controls how Save vendors dependencies.
+type SaveOptions struct {
+	// Packages lists patterns of the packages whose
+	// dependencies are saved. If empty, it is ./...
+	Packages []string
+
+	// Ignore lists patterns of packages never to vendor. They
+	// are added to the manifest's ignore list.
+	Ignore []string
+
+	// Unignore lists patterns to remove from the manifest's
+	// ignore list, so that matching packages are vendored again.
+	Unignore []string
+
+	// If Cache is not nil, new dependencies are found in and
+	// copied from the cache, not GOPATH, as for Cache.ListDeps.
+	Cache *cache.Cache
+
+	// StripNested deletes the copies of packages in vendor
+	// directories nested inside dependencies, when the manifest
+	// has those packages too.
+	StripNested bool
+
+	// Flatten hoists the packages in nested vendor directories
+	// into the top-level one, adding any the manifest lacks, and
+	// removes the nested directories.
+	Flatten bool
+
+	// ImportComments says what to do with the import comments
+	// of the files copied into vendor/.
+	ImportComments ImportCommentMode
+
+	// Rewrite changes the imports of vendored packages, in our
+	// packages and in vendor/, to their fully-qualified path,
+	// e.g. C/vendor/D rather than D.
+	Rewrite bool
+
+	// Vendor is the vendor directory to save into, which holds
+	// its own manifest. If empty, it is vendor/.
+	Vendor string
+
+	// AllowDirty records new dependencies whose checkouts have
+	// uncommitted changes, untracked files or unpushed commits,
+	// logging them, rather than failing.
+	AllowDirty bool
+}
+
+// SaveResult describes what Save did.
+type SaveResult struct {
+	Manifest Manifest          // As written.
+	Added    []pkgs.Dependency // New dependencies copied into the vendor directory.
+	Removed  []pkgs.Dependency // Dependencies no longer needed, deleted from it.
+	Report   Report            // The changes to the manifest, with their files.
+
+	// Unparsed lists the Go files copied without ImportComments
+	// applied, as their package clause couldn't be parsed.
+	Unparsed pkgs.Errors
+}
+
+// Save vendors the dependencies of the packages in the current
+// directory, and records them in the manifest of the vendor
+// directory.
+func Save(opts SaveOptions) (*SaveResult, error) {
+	args := opts.Packages
+	if len(args) == 0 {
+		args = []string{"./..."}
+	}
+	vendor := vendorDir(opts.Vendor)
+	ver, err := goVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := CurrentManifest(vendor)
+	if err != nil {
+		return nil, err
+	}
+	path, err := pkgs.ImportPath(".")
+	if err != nil {
+		return nil, err
+	}
+	manifest.ImportPath = path
+	manifest.GoVersion = ver
+	manifest.Ignore = removeIgnores(mergeIgnores(manifest.Ignore, opts.Ignore), opts.Unignore)
+
+	cons, err := ReadConstraints(ConstraintsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []pkgs.Dependency
+	ignore, err := ignorePatterns(&manifest, cons)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Cache != nil {
+		deps, err = opts.Cache.ListDeps(manifest.Deps, cons.source, ignore, args...)
+	} else {
+		deps, err = (&pkgs.Lister{Manifest: manifest.Deps}).ListDeps(ignore, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	old := manifest.Deps
+	rem := keepHoisted(subDeps(manifest.Deps, deps), deps)
+	add := subDeps(deps, manifest.Deps)
+	if err := checkClean(add, opts.AllowDirty); err != nil {
+		return nil, err
+	}
+	if err := preferPins(vendor, manifest.Deps, deps, add, cons, opts.Cache == nil); err != nil {
+		return nil, err
+	}
+	manifest.Deps = subDeps(manifest.Deps, rem)
+	sources := make(map[string]string) // import path → source
+	for _, dep := range manifest.Deps {
+		sources[dep.ImportPath] = dep.Source
+	}
+	manifest.Deps = append(manifest.Deps, add...)
+	if err := cons.apply(manifest.Deps); err != nil {
+		return nil, err
+	}
+	for _, dep := range manifest.Deps {
+		if err := dep.VerifySource(); err != nil {
+			return nil, err
+		}
+	}
+	// The revisions already recorded came from the old sources.
+	if err := verifySources(opts.Cache, changedSources(manifest.Deps, sources)); err != nil {
+		return nil, err
+	}
+	if err := checkForConflicts(manifest.Deps); err != nil {
+		return nil, err
+	}
+
+	pkgPaths := depPaths(old, manifest.Deps)
+	before, err := snapshot(vendor, depPaths(add, rem), pkgPaths)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeSrc(vendor, rem); err != nil {
+		return nil, err
+	}
+	if opts.Cache != nil {
+		if err := opts.Cache.CheckoutDeps(add); err != nil {
+			return nil, err
+		}
+	}
+	parent := vendorParent(manifest.ImportPath, vendor)
+	unparsed, err := copySrc(vendor, parent, add, opts.ImportComments)
+	if err != nil {
+		return nil, err
+	}
+	// Once flattened, keep flattening, or the hoisted packages'
+	// parents would bring back their nested copies.
+	flatten := opts.Flatten || hoisted(manifest.Deps)
+	if err := checkNested(vendor, manifest.ImportPath, manifest.Deps, opts.StripNested && !flatten); err != nil {
+		return nil, err
+	}
+	if flatten {
+		if err := flattenNested(vendor, &manifest); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Rewrite {
+		if err := rewriteTree(filepath.Dir(vendor), parent, qualifier(parent, manifest.Deps)); err != nil {
+			return nil, err
+		}
+	}
+
+	readme := filepath.Join(vendor, "README")
+	if writeFile(readme, strings.TrimSpace(Readme)+"\n"); err != nil {
+		log.Println(err)
+	}
+	report := diffDeps(old, manifest.Deps)
+	if err := report.countFiles(vendor, before, append(pkgPaths, depPaths(manifest.Deps)...)); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(vendor, "Deps.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := manifest.WriteTo(f); err != nil {
+		return nil, err
+	}
+	return &SaveResult{Manifest: manifest, Added: add, Removed: rem, Report: report, Unparsed: unparsed}, nil
+}
+
+func checkForConflicts(deps []pkgs.Dependency) error {
+	// We can't handle mismatched versions for packages in
+	// the same repo, so report that as an error.
+	for _, da := range deps {
+		for _, db := range deps {
+			switch {
+			case strings.HasPrefix(db.ImportPath, da.ImportPath+"/"):
+				if da.Rev != db.Rev {
+					return fmt.Errorf("conflicting revisions %s and %s", da.Rev, db.Rev)
+				}
+			case strings.HasPrefix(da.ImportPath, db.Root+"/"):
+				if da.Rev != db.Rev {
+					return fmt.Errorf("conflicting revisions %s and %s", da.Rev, db.Rev)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkClean fails, as pkgs.CheckClean does, if the checkouts of
+// deps in GOPATH can't be reproduced elsewhere. If allowDirty is
+// set, dirty checkouts are only logged.
+func checkClean(deps []pkgs.Dependency, allowDirty bool) error {
+	err := pkgs.CheckClean(deps)
+	var errs pkgs.Errors
+	if !allowDirty || !errors.As(err, &errs) {
+		return err
+	}
+	var rest pkgs.Errors
+	for _, perr := range errs {
+		if errors.Is(perr, pkgs.ErrDirty) {
+			log.Printf("warning: %v", perr)
+		} else {
+			rest = append(rest, perr)
+		}
+	}
+	return rest.Err()
+}
+
+// mergeIgnores returns the sorted union of the patterns in a and b.
+func mergeIgnores(a, b []string) []string {
+	seen := make(map[string]bool)
+	var pats []string
+	for _, pat := range append(append([]string{}, a...), b...) {
+		if !seen[pat] {
+			seen[pat] = true
+			pats = append(pats, pat)
+		}
+	}
+	sort.Strings(pats)
+	return pats
+}
+
+// changedSources returns the dependencies in deps with a Source
+// other than the one in sources, by import path. Those not in
+// sources are skipped.
+func changedSources(deps []pkgs.Dependency, sources map[string]string) []pkgs.Dependency {
+	var changed []pkgs.Dependency
+	for _, dep := range deps {
+		if source, ok := sources[dep.ImportPath]; ok && source != dep.Source {
+			changed = append(changed, dep)
+		}
+	}
+	return changed
+}
+
+// verifySources checks that the revisions of deps can be had from
+// their Source, or their canonical repo, by fetching them into c or,
+// if c is nil, as for pkgs.VerifySources.
+func verifySources(c *cache.Cache, deps []pkgs.Dependency) error {
+	if len(deps) == 0 {
+		return nil
+	}
+	if c != nil {
+		return c.CheckoutDeps(deps)
+	}
+	return pkgs.VerifySources(deps)
+}
+
+// removeIgnores returns the patterns in pats other than those in
+// rem. Patterns in rem that pats lacks are reported.
+func removeIgnores(pats, rem []string) []string {
+	var kept []string
+	for _, pat := range pats {
+		found := false
+		for _, r := range rem {
+			found = found || r == pat
+		}
+		if !found {
+			kept = append(kept, pat)
+		}
+	}
+	for _, r := range rem {
+		found := false
+		for _, pat := range pats {
+			found = found || r == pat
+		}
+		if !found {
+			log.Println("not in ignore list:", r)
+		}
+	}
+	return kept
+}
+
+// CurrentManifest reads the manifest in the vendor directory dir,
+// migrating a godep manifest if there is none in vendor/.
+func CurrentManifest(dir string) (Manifest, error) {
+	var man Manifest
+	err := ReadManifest(filepath.Join(dir, "Deps.json"), &man)
+	if os.IsNotExist(err) && dir == srcdir {
+		err = readLegacyManifest(&man)
+	}
+	if os.IsNotExist(err) {
+		return Manifest{Version: manifestVersion}, nil
+	}
+	if man.Deps == nil {
+		man.Deps = []pkgs.Dependency{}
+	}
+	return man, err
+}
+
+// vendorDir returns dir, or vendor/ if dir is empty.
+func vendorDir(dir string) string {
+	if dir == "" {
+		return srcdir
+	}
+	return dir
+}
+
+// vendorParent returns the import path of the package directory
+// holding the vendor directory dir, given the import path of the
+// current directory.
+func vendorParent(importPath, dir string) string {
+	return path.Join(importPath, filepath.ToSlash(filepath.Dir(dir)))
+}
+
+// subDeps returns a - b, using ImportPath for equality.
+func subDeps(a, b []pkgs.Dependency) (diff []pkgs.Dependency) {
+	diff = []pkgs.Dependency{}
+	for _, da := range a {
+		dupe := false
+		for _, db := range b {
+			if da.ImportPath == db.ImportPath {
+				dupe = true
+				break
+			}
+		}
+		if !dupe {
+			diff = append(diff, da)
+		}
+	}
+	return diff
+}
+
+func removeSrc(srcdir string, deps []pkgs.Dependency) error {
+	for _, dep := range deps {
+		path := filepath.FromSlash(dep.ImportPath)
+		err := os.RemoveAll(filepath.Join(srcdir, path))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySrc copies the source of deps into dir, the vendor directory
+// of the package with import path importPath. Import comments are
+// handled according to mode. Go files copied without mode applied,
+// as their package clause couldn't be parsed, are returned as
+// unparsed.
+func copySrc(dir, importPath string, deps []pkgs.Dependency, mode ImportCommentMode) (unparsed pkgs.Errors, err error) {
+	var errs pkgs.Errors
+	for _, dep := range deps {
+		srcdir := filepath.Join(dep.Workspace, "src")
+		rel, err := filepath.Rel(srcdir, dep.Dir)
+		if err != nil { // this should never happen
+			return nil, err
+		}
+		dstpkgroot := filepath.Join(dir, rel)
+		if err := os.RemoveAll(dstpkgroot); err != nil {
+			errs.Add(dep.ImportPath, dep.Dir, pkgs.PhaseCopy, err)
+			continue
+		}
+		w := fs.Walk(dep.Dir)
+		for w.Step() {
+			err := copyPkgFile(dir, srcdir, w, importPath, mode)
+			var cerr *importCommentError
+			if errors.As(err, &cerr) {
+				unparsed.Add(dep.ImportPath, dep.Dir, pkgs.PhaseCopy, err)
+			} else if err != nil {
+				errs.Add(dep.ImportPath, dep.Dir, pkgs.PhaseCopy, err)
+			}
+		}
+	}
+	return unparsed, errs.Err()
+}
+
+func copyPkgFile(dstroot, srcroot string, w *fs.Walker, importPath string, mode ImportCommentMode) error {
+	if w.Err() != nil {
+		return w.Err()
+	}
+	if c := w.Stat().Name()[0]; c == '.' || c == '_' {
+		// Skip directories using a rule similar to how
+		// the go tool enumerates packages.
+		// See $GOROOT/src/cmd/go/main.go:/matchPackagesInFs
+		w.SkipDir()
+	}
+	if w.Stat().IsDir() {
+		return nil
+	}
+	rel, err := filepath.Rel(srcroot, w.Path())
+	if err != nil { // this should never happen
+		return err
+	}
+	vendored := path.Join(importPath, srcdir, filepath.ToSlash(filepath.Dir(rel)))
+	return copyFile(filepath.Join(dstroot, rel), w.Path(), vendored, mode)
+}
+
+// copyFile copies a regular file from src to dst.
+// dst is opened with os.Create.
+// If the file name ends with .go, copyFile applies mode to
+// its canonical import path annotation, if any, rewriting
+// it to importPath if asked to.
+func copyFile(dst, src, importPath string, mode ImportCommentMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+
+	linkDst, err := os.Readlink(src)
+	if err == nil {
+		return os.Symlink(linkDst, dst)
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if strings.HasSuffix(dst, ".go") {
+		err = copyGoFile(w, r, src, mode, importPath)
+	} else {
+		_, err = io.Copy(w, r)
+	}
+	return err
+}
+
+// writeFile is like ioutil.WriteFile but it creates
+// intermediate directories with os.MkdirAll.
+func writeFile(name, body string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, []byte(body), 0666)
+}
+
+const (
+	Readme = `
+This directory tree is generated automatically by govend.
+
+Please do not edit.
+
+See https://github.com/azylman/govend for more information.
+`
+)
+
+// goVersion returns the version string of the Go compiler
+// currently installed, e.g. "go1.1rc3".
+func goVersion() (string, error) {
+	// govend might have been compiled with a different
+	// version, so we can't just use runtime.Version here.
+	cmd := exec.Command("go", "version")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	p := strings.Split(string(out), " ")
+	if len(p) < 3 {
+		return "", fmt.Errorf("Error splitting output of `go version`: Expected 3 or more elements, but there are < 3: %q", string(out))
+	}
+	return p[2], nil
+}
@@ -1,8 +1,9 @@
-package main
+package vend
 
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"math"
 	"os"
@@ -70,6 +71,14 @@ func TestSave(t *testing.T) {
 		want     []*node
 		wdep     Manifest
 		werr     bool
+		ignore   []string
+		unignore []string
+
+		stripNested bool
+		flatten     bool
+		rewrite     bool
+		args        []string
+		vendor      string
 	}{
 		{
 			desc: "simple case, one dependency",
@@ -374,6 +383,79 @@ func TestSave(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "source of existing dependency is checked",
+			cwd:  "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Govend.toml", "[[constraint]]\npattern = \"D\"\nsource = \"https://example.com/fork/D\"\n", nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{
+			desc: "source kept without a constraint",
+			cwd:  "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", &Manifest{
+							ImportPath: "C",
+							Deps: []pkgs.Dependency{
+								{ImportPath: "D", Comment: "D1", Source: "https://example.com/fork/D"},
+							},
+						}, nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1", Source: "https://example.com/fork/D"},
+				},
+			},
+		},
 		{
 			desc: "remove one dependency; keep other dependency version",
 			cwd:  "C",
@@ -678,6 +760,425 @@ func TestSave(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "ignore dependency with constraint",
+			cwd:  "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E/A"), nil},
+						{"Govend.toml", "[[constraint]]\npattern = \"E/...\"\nignore = true\n", nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D"), nil},
+				{"C/vendor/E/A/main.go", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{
+			desc:   "ignore dependency and what only it imports",
+			cwd:    "C",
+			ignore: []string{"E/..."},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E/A"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A", "F"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"F",
+					"",
+					[]*node{
+						{"main.go", pkg("F"), nil},
+						{"+git", "F1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D"), nil},
+				{"C/vendor/E", "(absent)", nil},
+				{"C/vendor/F", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Ignore:     []string{"E/..."},
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{
+			desc:     "unignore dependency",
+			cwd:      "C",
+			unignore: []string{"E/..."},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"vendor/Deps.json", &Manifest{ImportPath: "C", Ignore: []string{"D/...", "E/..."}}, nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D", "(absent)", nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Ignore:     []string{"D/..."},
+				Deps: []pkgs.Dependency{
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc:   "ignore dependency missing from GOPATH",
+			cwd:    "C",
+			ignore: []string{"E/..."},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E/A"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Ignore:     []string{"E/..."},
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{
+			desc:        "strip nested vendor copy",
+			cwd:         "C",
+			stripNested: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E"), nil},
+						{"vendor/E/main.go", pkg("E") + "// old copy\n", nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "E"), nil},
+				{"C/vendor/E/main.go", pkg("E"), nil},
+				{"C/vendor/D/vendor", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc:    "flatten nested vendor directory",
+			cwd:     "C",
+			flatten: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "F"), nil},
+						{"vendor/F/main.go", pkg("F"), nil},
+						{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "F", "Comment": "F1", "Rev": "f1"}]}`, nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "F"), nil},
+				{"C/vendor/F/main.go", pkg("F"), nil},
+				{"C/vendor/D/vendor", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "F", Comment: "F1", VendoredBy: "D"},
+				},
+			},
+		},
+		{
+			desc: "prefer revision pinned by dependency's own manifest",
+			cwd:  "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E"), nil},
+						{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "E", "Comment": "E1", "Rev": "E1"}]}`, nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "E"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc: "move whole repo to the revision pinned for one of its packages",
+			cwd:  "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E/A", "E/B"), nil},
+						{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "E/A", "Comment": "E1", "Rev": "E1"}]}`, nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("E1"), nil},
+						{"B/main.go", pkg("B") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"A/main.go", pkg("A") + decl("E2"), nil},
+						{"B/main.go", pkg("B") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/E/A/main.go", pkg("A") + decl("E1"), nil},
+				{"C/vendor/E/B/main.go", pkg("B") + decl("E1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E/A", Comment: "E1"},
+					{ImportPath: "E/B", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc:   "profile with its own vendor directory",
+			cwd:    "C",
+			args:   []string{"./cmd/api/..."},
+			vendor: "cmd/api/vendor",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"cmd/api/main.go", pkg("main", "D"), nil},
+						{"cmd/web/main.go", pkg("main", "E"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/cmd/api/vendor/D/main.go", pkg("D"), nil},
+				{"C/cmd/api/vendor/E/main.go", "(absent)", nil},
+				{"C/vendor", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{
+			desc:    "rewrite imports to vendor paths",
+			cwd:     "C",
+			rewrite: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "D/P"), nil},
+						{"P/main.go", pkg("P"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/vendor/D"), nil},
+				{"C/vendor/D/main.go", pkg("D", "C/vendor/D/P"), nil},
+				{"C/vendor/D/P/main.go", pkg("P"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
 	}
 
 	wd, err := os.Getwd()
@@ -703,10 +1204,20 @@ func TestSave(t *testing.T) {
 		if err := os.Setenv("GOPATH", root1+string(os.PathListSeparator)+root2); err != nil {
 			panic(err)
 		}
+		opts := SaveOptions{
+			Packages:    test.args,
+			Ignore:      test.ignore,
+			Unignore:    test.unignore,
+			StripNested: test.stripNested,
+			Flatten:     test.flatten,
+			Rewrite:     test.rewrite,
+			Vendor:      test.vendor,
+		}
 		if test.werr {
-			assert.NotNil(t, save([]string{}))
+			_, err := Save(opts)
+			assert.NotNil(t, err)
 		} else {
-			if err := save([]string{}); err != nil {
+			if _, err := Save(opts); err != nil {
 				t.Fatalf("got unexpected error %s", err.Error())
 			}
 		}
@@ -716,13 +1227,14 @@ func TestSave(t *testing.T) {
 
 		checkTree(t, &node{src, "", test.want})
 
-		f, err := os.Open(filepath.Join(dir, "vendor/Deps.json"))
+		f, err := os.Open(filepath.Join(dir, vendorDir(test.vendor), "Deps.json"))
 		assert.Nil(t, err)
 		g := new(Manifest)
 		assert.Nil(t, json.NewDecoder(f).Decode(g))
 		f.Close()
 
 		assert.Equal(t, g.ImportPath, test.wdep.ImportPath)
+		assert.Equal(t, test.wdep.Ignore, g.Ignore)
 		for i := range g.Deps {
 			g.Deps[i].Rev = ""
 		}
@@ -816,25 +1328,63 @@ func run(t *testing.T, dir, name string, args ...string) string {
 	return string(out)
 }
 
-func TestStripImportComment(t *testing.T) {
-	var cases = []struct{ s, w string }{
-		{`package foo`, `package foo`},
-		{`anything else`, `anything else`},
-		{`package foo // import "bar/foo"`, `package foo`},
-		{`package foo /* import "bar/foo" */`, `package foo`},
-		{`package  foo  //  import  "bar/foo" `, `package  foo`},
-		{"package foo // import `bar/foo`", `package foo`},
-		{`package foo /* import "bar/foo" */; var x int`, `package foo; var x int`},
-		{`package foo // import "bar/foo" garbage`, `package foo // import "bar/foo" garbage`},
-		{`package xpackage foo // import "bar/foo"`, `package xpackage foo // import "bar/foo"`},
-	}
+func TestSaveAfterFlatten(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	const scratch = "deptest"
+	defer os.RemoveAll(scratch)
+	assert.Nil(t, os.RemoveAll(scratch))
+	src := filepath.Join(scratch, "r1", "src")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D"), nil},
+				{"+git", "", nil},
+			},
+		},
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D", "F"), nil},
+				{"vendor/F/main.go", pkg("F"), nil},
+				{"Godeps/Godeps.json", `{"ImportPath": "D", "Deps": [{"ImportPath": "F", "Comment": "F1", "Rev": "f1"}]}`, nil},
+				{"+git", "D1", nil},
+			},
+		},
+	}}, "")
+	assert.Nil(t, os.Chdir(filepath.Join(wd, src, "C")))
+	defer os.Chdir(wd)
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	assert.Nil(t, os.Setenv("GOPATH", filepath.Join(wd, scratch, "r1")))
 
-	for _, test := range cases {
-		assert.Equal(t, string(stripImportComment([]byte(test.s))), test.w)
+	// F lives only in C/vendor once hoisted, not in GOPATH.
+	_, err = Save(SaveOptions{Flatten: true})
+	assert.Nil(t, err)
+	_, err = Save(SaveOptions{})
+	assert.Nil(t, err)
+	_, err = Update(UpdateOptions{Deps: []string{"D"}})
+	assert.Nil(t, err)
+	var g Manifest
+	assert.Nil(t, ReadManifest(filepath.Join("vendor", "Deps.json"), &g))
+	for i := range g.Deps {
+		g.Deps[i].Rev = ""
 	}
+	assert.Equal(t, []pkgs.Dependency{
+		{ImportPath: "D", Comment: "D1"},
+		{ImportPath: "F", Comment: "F1", VendoredBy: "D"},
+	}, g.Deps)
+	assert.Nil(t, os.Chdir(wd))
+	checkTree(t, &node{src, "", []*node{
+		{"C/vendor/D/main.go", pkg("D", "F"), nil},
+		{"C/vendor/F/main.go", pkg("F"), nil},
+		{"C/vendor/D/vendor", "(absent)", nil},
+	}})
 }
 
-func TestCopyWithoutImportCommentLongLines(t *testing.T) {
+func TestCopyGoFileLongLines(t *testing.T) {
 	tmp := make([]byte, int(math.Pow(2, 16)))
 	for i, _ := range tmp {
 		tmp[i] = 111 // fill it with "o"s
@@ -844,5 +1394,10 @@ func TestCopyWithoutImportCommentLongLines(t *testing.T) {
 
 	o := new(bytes.Buffer)
 	i := strings.NewReader(iStr)
-	assert.Nil(t, copyWithoutImportComment(o, i))
+	// The literal \n after the package name doesn't parse, so
+	// the file is copied as is and reported.
+	err := copyGoFile(o, i, "foo.go", StripImportComments, "")
+	var cerr *importCommentError
+	assert.True(t, errors.As(err, &cerr), "%v", err)
+	assert.Equal(t, iStr+"\n", o.String())
 }
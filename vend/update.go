@@ -0,0 +1,381 @@
+package vend
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azylman/govend/cache"
+	"github.com/azylman/govend/pkgs"
+	"github.com/azylman/govend/semver"
+)
+
+// UpdateOptions controls how Update moves dependencies.
+type UpdateOptions struct {
+	// Deps lists patterns of the dependencies to update.
+	// If empty, it is ./..., meaning all of them. The other
+	// dependencies from the repos of those matched are
+	// updated with them.
+	Deps []string
+
+	// Packages lists patterns of our packages, as for Save. The
+	// dependencies they need after the update are added, and those
+	// they no longer need are removed.
+	Packages []string
+
+	// If Cache is not nil, dependencies are moved to the tip of
+	// their upstream repos, fetched into the cache, rather than
+	// to the revisions checked out in GOPATH, and the packages
+	// they newly import are found in the cache as well, as for
+	// Cache.ListDeps. Otherwise, repos missing from GOPATH are
+	// cloned into its first workspace.
+	Cache *cache.Cache
+
+	// If Tags is set, dependencies are moved to the highest semver
+	// tag of their repo instead, which is checked out in GOPATH
+	// first when not using the cache. The tag must satisfy Version,
+	// if given, or else the dependency's version constraint, if any.
+	Tags    bool
+	Version string
+
+	// ImportComments says what to do with the import comments
+	// of the files copied into vendor/.
+	ImportComments ImportCommentMode
+
+	// Rewrite changes the imports of vendored packages to their
+	// fully-qualified path, as for Save.
+	Rewrite bool
+
+	// Vendor is the vendor directory to update, as for Save.
+	Vendor string
+
+	// Changelog collects the history each updated repo moved
+	// over into UpdateResult.Changelog.
+	Changelog bool
+
+	// AllowDirty records revisions from dirty checkouts in
+	// GOPATH, as for Save.
+	AllowDirty bool
+}
+
+// UpdateResult describes what Update did.
+type UpdateResult struct {
+	Manifest Manifest          // As written.
+	Updated  []pkgs.Dependency // The new revisions of the dependencies updated.
+	Added    []pkgs.Dependency // New dependencies of the updated ones.
+	Removed  []pkgs.Dependency // Dependencies no longer needed.
+	Report   Report            // The changes to the manifest, with their files.
+
+	// Changelog is the history of each updated repo, by root, if
+	// asked for. Write it as Markdown with WriteChangelog.
+	Changelog []RepoLog
+
+	// Unparsed lists the Go files copied without ImportComments
+	// applied, as their package clause couldn't be parsed.
+	Unparsed pkgs.Errors
+}
+
+// Update moves dependencies to newer revisions.
+func Update(opts UpdateOptions) (*UpdateResult, error) {
+	args := opts.Deps
+	if len(args) == 0 {
+		args = []string{"./..."}
+	}
+	vendor := vendorDir(opts.Vendor)
+	var g Manifest
+	manifest := filepath.Join(vendor, "Deps.json")
+	if err := ReadManifest(manifest, &g); err != nil {
+		return nil, err
+	}
+	cons, err := ReadConstraints(ConstraintsFile)
+	if err != nil {
+		return nil, err
+	}
+	matched, revs, err := filter(args, OwnDeps(g.Deps))
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := ignorePatterns(&g, cons)
+	if err != nil {
+		return nil, err
+	}
+	kept := ignoreDeps(ignore, matched)
+	if err := checkIgnoredRepos(kept, subDeps(matched, kept)); err != nil {
+		return nil, err
+	}
+	matched = kept
+	// Dependencies given a revision with @rev go there, the rest
+	// to the tip or the highest tag.
+	var pinned, rest []pkgs.Dependency
+	for _, dep := range matched {
+		dep.Tag = ""
+		if rev := revs[dep.Root]; rev != "" {
+			dep.Rev = rev
+			pinned = append(pinned, dep)
+		} else {
+			rest = append(rest, dep)
+		}
+	}
+	var constraint func(string) *semver.Constraint
+	if opts.Tags {
+		if constraint, err = cons.tagConstraint(opts.Version); err != nil {
+			return nil, err
+		}
+	}
+	var deps []pkgs.Dependency
+	if opts.Cache != nil {
+		deps, err = opts.Cache.Update(rest, constraint)
+		if err == nil {
+			err = opts.Cache.CheckoutRevs(pinned)
+			deps = append(deps, pinned...)
+		}
+	} else {
+		// The cache fetches the repos it lacks itself.
+		if err := pkgs.FetchMissing(matched, false); err != nil {
+			return nil, err
+		}
+		if opts.Tags {
+			if err := pkgs.CheckoutTags(rest, constraint); err != nil {
+				return nil, err
+			}
+		}
+		if err := pkgs.CheckoutRevs(pinned); err != nil {
+			return nil, err
+		}
+		deps, err = pkgs.LoadVCSAndUpdate(append(rest, pinned...))
+		if err == nil {
+			err = checkClean(deps, opts.AllowDirty)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(deps) == 0 {
+		return nil, errors.New("no packages can be updated")
+	}
+	if err := cons.apply(deps); err != nil {
+		return nil, err
+	}
+	// Take out the old revisions, put in the new ones
+	old := g.Deps
+	g.Deps = subDeps(g.Deps, matched)
+	g.Deps = append(g.Deps, deps...)
+
+	pkgPaths := depPaths(old, g.Deps)
+	before, err := snapshot(vendor, depPaths(matched, deps), pkgPaths)
+	if err != nil {
+		return nil, err
+	}
+	parent := vendorParent(g.ImportPath, vendor)
+	unparsed, err := copySrc(vendor, parent, deps, opts.ImportComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new revisions may import packages we don't have yet, or
+	// stop importing ones nothing else needs. go list sees the
+	// vendored copies, so this must come after copying them.
+	pkgArgs := opts.Packages
+	if len(pkgArgs) == 0 {
+		pkgArgs = []string{"./..."}
+	}
+	var listed []pkgs.Dependency
+	if opts.Cache != nil {
+		listed, err = opts.Cache.ListDeps(g.Deps, cons.source, ignore, pkgArgs...)
+	} else {
+		listed, err = (&pkgs.Lister{Manifest: g.Deps}).ListDeps(ignore, pkgArgs...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rem := keepHoisted(subDeps(g.Deps, listed), listed)
+	add := subDeps(listed, g.Deps)
+	if err := checkClean(add, opts.AllowDirty); err != nil {
+		return nil, err
+	}
+	if err := preferPins(vendor, g.Deps, listed, add, cons, opts.Cache == nil); err != nil {
+		return nil, err
+	}
+	if err := cons.apply(add); err != nil {
+		return nil, err
+	}
+	for _, dep := range add {
+		if err := dep.VerifySource(); err != nil {
+			return nil, err
+		}
+	}
+	g.Deps = subDeps(g.Deps, rem)
+	g.Deps = append(g.Deps, add...)
+	if err := checkForConflicts(g.Deps); err != nil {
+		return nil, err
+	}
+	pkgPaths = append(pkgPaths, depPaths(add)...)
+	remSums, err := snapshot(vendor, depPaths(rem), pkgPaths)
+	if err != nil {
+		return nil, err
+	}
+	for p, sums := range remSums {
+		before[p] = sums
+	}
+	if err := removeSrc(vendor, rem); err != nil {
+		return nil, err
+	}
+	if opts.Cache != nil {
+		if err := opts.Cache.CheckoutDeps(add); err != nil {
+			return nil, err
+		}
+	}
+	addUnparsed, err := copySrc(vendor, parent, add, opts.ImportComments)
+	if err != nil {
+		return nil, err
+	}
+	unparsed = append(unparsed, addUnparsed...)
+	if hoisted(g.Deps) {
+		if err := flattenNested(vendor, &g); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Rewrite {
+		if err := rewriteTree(filepath.Dir(vendor), parent, qualifier(parent, g.Deps)); err != nil {
+			return nil, err
+		}
+	}
+	report := diffDeps(old, g.Deps)
+	if err := report.countFiles(vendor, before, append(pkgPaths, depPaths(g.Deps)...)); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(manifest)
+	if err != nil {
+		return nil, err
+	}
+	_, err = g.WriteTo(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	res := &UpdateResult{Manifest: g, Updated: deps, Added: add, Removed: rem, Report: report, Unparsed: unparsed}
+	if opts.Changelog {
+		res.Changelog = changelog(opts.Cache, old, deps)
+	}
+	return res, nil
+}
+
+// ignoreDeps returns the dependencies in deps that
+// don't match ignore.
+func ignoreDeps(ignore pkgs.Patterns, deps []pkgs.Dependency) []pkgs.Dependency {
+	kept := []pkgs.Dependency{}
+	for _, dep := range deps {
+		if !ignore.Match(dep.ImportPath) {
+			kept = append(kept, dep)
+		}
+	}
+	return kept
+}
+
+// checkIgnoredRepos returns an error if any of ignored, dependencies
+// left out of an update by the ignore list, shares its repo with one
+// of kept, since a repo's packages must stay at one revision.
+func checkIgnoredRepos(kept, ignored []pkgs.Dependency) error {
+	if len(ignored) == 0 || len(kept) == 0 {
+		return nil
+	}
+	all := append(append([]pkgs.Dependency{}, kept...), ignored...)
+	if err := pkgs.FillRoots(all); err != nil {
+		return err
+	}
+	roots := make(map[string]string) // repo root → import path kept
+	for _, dep := range all[:len(kept)] {
+		roots[dep.Root] = dep.ImportPath
+	}
+	for _, dep := range all[len(kept):] {
+		if p, ok := roots[dep.Root]; ok {
+			return fmt.Errorf("%s is ignored, but %s, from the same repo %s, is to be updated; unignore it, or ignore the whole repo", dep.ImportPath, p, dep.Root)
+		}
+	}
+	return nil
+}
+
+// filter returns the dependencies in deps that args match, as
+// pkgs.Patterns where ./... means every dependency, with the other
+// packages of their repos, as for expandRepos, which are logged. It
+// also returns the revisions the patterns give, by repo root.
+func filter(args []string, deps []pkgs.Dependency) ([]pkgs.Dependency, map[string]string, error) {
+	var pats pkgs.Patterns
+	negated := true
+	for _, arg := range args {
+		if arg == "./..." {
+			arg = "..."
+		}
+		p, err := pkgs.ParsePattern(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		negated = negated && p.Negate
+		pats = append(pats, p)
+	}
+	if negated {
+		pats = append(pkgs.Patterns{{Path: "..."}}, pats...)
+	}
+	if len(pats) == 1 && pats[0] == (pkgs.Pattern{Path: "..."}) {
+		return deps, nil, nil
+	}
+	deps = append([]pkgs.Dependency{}, deps...)
+	if err := pkgs.FillRoots(deps); err != nil {
+		return nil, nil, err
+	}
+	matched, siblings, revs := expandRepos(pats, deps)
+	var roots []string
+	for root := range siblings {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		log.Printf("also updating %s, from the same repo %s", strings.Join(siblings[root], ", "), root)
+	}
+	for _, p := range pats {
+		found := false
+		for _, dep := range deps {
+			found = found || p.MatchDep(dep)
+		}
+		if !found && !p.Negate {
+			log.Println("not in manifest:", p.Path)
+		}
+	}
+	return matched, revs, nil
+}
+
+// expandRepos returns the dependencies in deps, whose Roots must be
+// set, that pats match, together with every other one in the same
+// repo, since a repo's packages share one revision and are updated
+// as a unit. It also returns the import paths of the dependencies
+// pulled in that way and the revisions pats give, both by repo root.
+func expandRepos(pats pkgs.Patterns, deps []pkgs.Dependency) (matched []pkgs.Dependency, siblings map[string][]string, revs map[string]string) {
+	roots := make(map[string]bool)
+	revs = make(map[string]string)
+	for _, dep := range deps {
+		if pats.MatchDep(dep) {
+			roots[dep.Root] = true
+			if rev := pats.Rev(dep); rev != "" {
+				revs[dep.Root] = rev
+			}
+		}
+	}
+	matched = []pkgs.Dependency{}
+	siblings = make(map[string][]string)
+	for _, dep := range deps {
+		if !roots[dep.Root] {
+			continue
+		}
+		if !pats.MatchDep(dep) {
+			siblings[dep.Root] = append(siblings[dep.Root], dep.ImportPath)
+		}
+		matched = append(matched, dep)
+	}
+	return matched, siblings, revs
+}
@@ -0,0 +1,846 @@
+package vend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azylman/govend/pkgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	var cases = []struct {
+		desc  string
+		cwd   string
+		args  []string
+		start []*node
+		want  []*node
+		wdep  Manifest
+		werr  bool
+		tags  bool
+		dirty bool // AllowDirty
+
+		// If set, err must hold a *pkgs.PackageError for wpkg in this phase.
+		wphase string
+		wpkg   string
+
+		// If set, the number of commits in the changelog, by repo root.
+		wchangelog map[string]int
+	}{
+		{
+			desc: "simple case, update one dependency",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+			wchangelog: map[string]int{"D": 1},
+		},
+		{
+			desc: "update one dependency, keep other one",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D", "E") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D", "E") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "E") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc: "update all dependencies",
+			cwd:  "C",
+			args: []string{"..."},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+					{ImportPath: "E", Comment: "E2"},
+				},
+			},
+		},
+		{
+			desc: "update all dependencies",
+			cwd:  "C",
+			args: []string{"./..."},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+					{ImportPath: "E", Comment: "E2"},
+				},
+			},
+		},
+		{
+			desc: "update adds new transitive dependency",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D", "E") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D", "E") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc: "update removes orphaned dependency",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D", "E") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+				{"C/vendor/E/main.go", "(absent)", nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+		},
+		{
+			desc: "one match of two patterns",
+			cwd:  "C",
+			args: []string{"D", "X"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+		},
+		{
+			desc: "dirty dependency",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"main.go", pkg("D") + decl("D3"), nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr:   true,
+			wphase: pkgs.PhaseVCS,
+			wpkg:   "D",
+		},
+		{
+			desc: "untracked file in dependency",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"extra.go", pkg("D"), nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr:   true,
+			wphase: pkgs.PhaseVCS,
+			wpkg:   "D",
+		},
+		{
+			desc:  "dirty dependency allowed",
+			cwd:   "C",
+			args:  []string{"D"},
+			dirty: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"main.go", pkg("D") + decl("D3"), nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D3"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+		},
+		{
+			desc: "no matches",
+			cwd:  "C",
+			args: []string{"X"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{
+			desc: "exclude a dependency",
+			cwd:  "C",
+			args: []string{"-E"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1", "E", "E1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+		},
+		{
+			desc: "ignored package from an updated repo",
+			cwd:  "C",
+			args: []string{"D/A"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("D1"), nil},
+						{"B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"A/main.go", pkg("A") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D/A"), nil},
+						{"vendor/Deps.json", &Manifest{
+							ImportPath: "C",
+							Ignore:     []string{"D/B"},
+							Deps: []pkgs.Dependency{
+								{ImportPath: "D/A", Comment: "D1"},
+								{ImportPath: "D/B", Comment: "D1"},
+							},
+						}, nil},
+						{"vendor/D/A/main.go", pkg("A") + decl("D1"), nil},
+						{"vendor/D/B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/A/main.go", pkg("A") + decl("D1"), nil},
+				{"C/vendor/D/B/main.go", pkg("B") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D/A", Comment: "D1"},
+					{ImportPath: "D/B", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{
+			desc: "update to a given revision",
+			cwd:  "C",
+			args: []string{"D@D2"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"main.go", pkg("D") + decl("D3"), nil},
+						{"+git", "D3", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"vendor/Deps.json", deps("C", "D", "D1"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "D2"},
+				},
+			},
+		},
+		{
+			desc: "update just one package of two in a repo updates both",
+			cwd:  "C",
+			args: []string{"D/A", "E"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("D1"), nil},
+						{"B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"A/main.go", pkg("A") + decl("D2"), nil},
+						{"B/main.go", pkg("B") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"main.go", pkg("E") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D/A", "D/B", "E"), nil},
+						{"vendor/Deps.json", deps("C", "D/A", "D1", "D/B", "D1", "E", "E1"), nil},
+						{"vendor/D/A/main.go", pkg("A") + decl("D1"), nil},
+						{"vendor/D/B/main.go", pkg("B") + decl("D1"), nil},
+						{"vendor/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/A/main.go", pkg("A") + decl("D2"), nil},
+				{"C/vendor/D/B/main.go", pkg("B") + decl("D2"), nil},
+				{"C/vendor/E/main.go", pkg("E") + decl("E2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D/A", Comment: "D2"},
+					{ImportPath: "D/B", Comment: "D2"},
+					{ImportPath: "E", Comment: "E2"},
+				},
+			},
+		},
+		{
+			desc: "update violates version constraint",
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "v1.0.0", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "v2.0.0", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Govend.toml", "[[constraint]]\npattern = \"D\"\nversion = \"^1.0\"\n", nil},
+						{"vendor/Deps.json", deps("C", "D", "v1.0.0"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D1"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "v1.0.0"},
+				},
+			},
+			werr: true,
+		},
+		{
+			desc: "update to highest tag satisfying constraint",
+			cwd:  "C",
+			args: []string{"D"},
+			tags: true,
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "v1.0.0", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "v1.1.0", nil},
+						{"main.go", pkg("D") + decl("D3"), nil},
+						{"+git", "v2.0.0", nil},
+						{"main.go", pkg("D") + decl("D4"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Govend.toml", "[[constraint]]\npattern = \"D\"\nversion = \"^1.0\"\n", nil},
+						{"vendor/Deps.json", deps("C", "D", "v1.0.0"), nil},
+						{"vendor/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			wdep: Manifest{
+				ImportPath: "C",
+				Deps: []pkgs.Dependency{
+					{ImportPath: "D", Comment: "v1.1.0", Tag: "v1.1.0"},
+				},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	const scratch = "deptest"
+	defer os.RemoveAll(scratch)
+	for i, test := range cases {
+		t.Logf(test.desc)
+		gopath := filepath.Join(scratch, fmt.Sprintf("%d", i))
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, test.cwd)
+		if err := os.Chdir(dir); err != nil {
+			panic(err)
+		}
+		if err := os.Setenv("GOPATH", filepath.Join(wd, gopath)); err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		res, err := Update(UpdateOptions{Deps: test.args, Tags: test.tags, AllowDirty: test.dirty, Changelog: true})
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("update err = %v (%v) want %v", g, err, test.werr)
+		}
+		if test.wchangelog != nil {
+			g := make(map[string]int)
+			for _, rl := range res.Changelog {
+				g[rl.Root] = len(rl.Commits)
+			}
+			assert.Equal(t, test.wchangelog, g, test.desc)
+		}
+		if test.wphase != "" {
+			var perr *pkgs.PackageError
+			if assert.True(t, errors.As(err, &perr), test.desc) {
+				assert.Equal(t, test.wphase, perr.Phase, test.desc)
+				assert.Equal(t, test.wpkg, perr.ImportPath, test.desc)
+			}
+		}
+		if err := os.Chdir(wd); err != nil {
+			panic(err)
+		}
+
+		checkTree(t, &node{src, "", test.want})
+
+		f, err := os.Open(filepath.Join(dir, "vendor/Deps.json"))
+		assert.Nil(t, err)
+		g := new(Manifest)
+		assert.Nil(t, json.NewDecoder(f).Decode(g))
+		f.Close()
+
+		assert.Equal(t, g.ImportPath, test.wdep.ImportPath)
+		for i := range g.Deps {
+			g.Deps[i].Rev = ""
+		}
+		assert.Equal(t, test.wdep.Deps, g.Deps)
+	}
+}
+
+func TestExpandRepos(t *testing.T) {
+	deps := []pkgs.Dependency{
+		{ImportPath: "golang.org/x/net/context", Root: "golang.org/x/net"},
+		{ImportPath: "golang.org/x/net/http2", Root: "golang.org/x/net"},
+		{ImportPath: "golang.org/x/net/http2/hpack", Root: "golang.org/x/net"},
+		{ImportPath: "golang.org/x/text/unicode", Root: "golang.org/x/text"},
+	}
+	pats, err := pkgs.ParsePatterns([]string{"golang.org/x/net/context@v1", "-golang.org/x/net/http2/..."})
+	assert.Nil(t, err)
+	matched, siblings, revs := expandRepos(pats, deps)
+	assert.Equal(t, deps[:3], matched)
+	assert.Equal(t, map[string][]string{
+		"golang.org/x/net": {"golang.org/x/net/http2", "golang.org/x/net/http2/hpack"},
+	}, siblings)
+	assert.Equal(t, map[string]string{"golang.org/x/net": "v1"}, revs)
+}
@@ -0,0 +1,59 @@
+package vend
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// VerifyOptions controls what Verify checks.
+type VerifyOptions struct {
+	Vendor string // As for Save.
+}
+
+// VerifyResult lists the ways the vendor directory
+// and its manifest disagree.
+type VerifyResult struct {
+	Missing    []string // Packages in the manifest with no files vendored.
+	Unrecorded []string // Vendored packages the manifest doesn't have.
+}
+
+// OK reports whether the vendor directory matches its manifest.
+func (r *VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unrecorded) == 0
+}
+
+// Verify checks that every package in the manifest is vendored,
+// and that no other packages are.
+func Verify(opts VerifyOptions) (*VerifyResult, error) {
+	vendor := vendorDir(opts.Vendor)
+	manifest, err := CurrentManifest(vendor)
+	if err != nil {
+		return nil, err
+	}
+	vendored, err := listPkgDirs(vendor)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := new(VerifyResult)
+	for _, dep := range manifest.Deps {
+		dir := filepath.Join(vendor, filepath.FromSlash(dep.ImportPath))
+		if !hasGoFiles(dir) {
+			r.Missing = append(r.Missing, dep.ImportPath)
+		}
+	}
+	for _, p := range vendored {
+		if _, ok := findDep(manifest.Deps, p); !ok {
+			r.Unrecorded = append(r.Unrecorded, p)
+		}
+	}
+	return r, nil
+}
+
+// hasGoFiles reports whether dir holds any .go files.
+func hasGoFiles(dir string) bool {
+	m, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(m) > 0
+}
@@ -0,0 +1,36 @@
+package vend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "govend")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	vendor := filepath.Join(tmp, "vendor")
+	assert.Nil(t, os.MkdirAll(vendor, 0777))
+	f, err := os.Create(filepath.Join(vendor, "Deps.json"))
+	assert.Nil(t, err)
+	_, err = deps("C", "D", "", "D/A", "", "E", "").WriteTo(f)
+	assert.Nil(t, err)
+	f.Close()
+
+	assert.Nil(t, writeFile(filepath.Join(vendor, "D", "main.go"), pkg("D")))
+	assert.Nil(t, writeFile(filepath.Join(vendor, "D", "A", "a.go"), pkg("A")))
+	assert.Nil(t, writeFile(filepath.Join(vendor, "D", "B", "b.go"), pkg("B")))
+	assert.Nil(t, writeFile(filepath.Join(vendor, "F", "f.go"), pkg("F")))
+	assert.Nil(t, writeFile(filepath.Join(vendor, "E", "README"), "no code"))
+
+	r, err := Verify(VerifyOptions{Vendor: vendor})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"E"}, r.Missing)
+	assert.Equal(t, []string{"F"}, r.Unrecorded) // D/B is part of D.
+	assert.False(t, r.OK())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/azylman/govend/vend"
+)
+
+var cmdVerify = &Command{
+	Name:  "verify",
+	Short: "check that vendor/ holds exactly the packages in the manifest",
+	Run:   runVerify,
+}
+
+var verifyProfile string
+
+func init() {
+	cmdVerify.Flag.StringVar(&verifyProfile, "profile", "", "check the vendor directory of the `profile` named in Govend.toml")
+}
+
+func runVerify(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		cmd.usage()
+	}
+	var opts vend.VerifyOptions
+	if verifyProfile != "" {
+		p, err := lookupProfile(verifyProfile)
+		if err != nil {
+			return err
+		}
+		opts.Vendor = p.Vendor
+	}
+	r, err := vend.Verify(opts)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Missing {
+		fmt.Println("missing:", p)
+	}
+	for _, p := range r.Unrecorded {
+		fmt.Println("not in manifest:", p)
+	}
+	if !r.OK() {
+		return errors.New("vendor directory does not match manifest")
+	}
+	return nil
+}